@@ -10,83 +10,280 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
 )
 
+const (
+	ProviderSeparator = "@" // References like name@file point to another provider and are not renamed
+)
+
 type ChildController struct {
-	Name       string
-	URL        string
-	Timeout    time.Duration
-	RootCAFile string
-	lastFetch  time.Time
-	lastConfig *traefikconfig.Configuration
+	Name         string
+	URL          string
+	Timeout      time.Duration
+	RootCAFile   string
+	MaxStaleness time.Duration // How long the last good configuration is served while the child fails
+	Weight       int           // Weight of the services of the child when conflicting routers are combined
+	// Authentication towards the child, the token and password files are read on every fetch so rotated secrets are used
+	ClientCertificate *reloadingKeyPair
+	BearerToken       string
+	BearerTokenFile   string
+	Username          string
+	Password          string
+	PasswordFile      string
+	lock              sync.Mutex
+	lastFetch         map[string]time.Time // Per view, "" is the full configuration
+	lastConfig        map[string]*traefikconfig.Configuration
+	lastETag          map[string]string // Sent as If-None-Match, an unchanged configuration is answered with 304
+	clientLock        sync.Mutex
+	httpClient        *http.Client
+	tlsModTime        time.Time             // Latest modification of the CA and client certificate files the client was built with
+	source            ChildControllerConfig // Configuration the child was created from, unchanged children are kept on reload
 }
 
-// FetchConfiguration fetches the Traefik configuration from a child controller
-func (c *ChildController) FetchConfiguration(ctx context.Context) (*traefikconfig.Configuration, error) {
-	if Config.Debug {
-		log.Printf("@D Fetching configuration from child controller: %s (%s)\n", c.Name, c.URL)
+// getChildConfigsFromEnv loads children from TOOC_CHILDREN_<n>_<FIELD> environment variables in index order.
+// The variables override the fields of the child with the same index in children, the children from the file.
+func getChildConfigsFromEnv(children []ChildControllerConfig) []ChildControllerConfig {
+	childConfigs := make(map[int]*ChildControllerConfig)
+	for i := range children {
+		childConfig := children[i]
+		childConfigs[i] = &childConfig
 	}
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, "TOOC_CHILDREN_") {
+			parts := strings.SplitN(env, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			key := parts[0]
+			value := parts[1]
+
+			// Extract index and field from TOOC_CHILDREN_0_NAME format
+			after := strings.TrimPrefix(key, "TOOC_CHILDREN_")
+			tokens := strings.SplitN(after, "_", 2)
+			if len(tokens) != 2 {
+				continue
+			}
 
-	// Create HTTP client with optional custom CA
-	tlsConfig := &tls.Config{}
+			index, err := strconv.Atoi(tokens[0])
+			if err != nil {
+				continue
+			}
 
-	if c.RootCAFile != "" {
-		caCert, err := os.ReadFile(c.RootCAFile)
-		if err != nil {
-			if Config.Prometheus.Enabled {
-				child_fetch_errors.WithLabelValues(c.Name).Inc()
+			field := tokens[1]
+
+			if childConfigs[index] == nil {
+				childConfigs[index] = &ChildControllerConfig{}
+			}
+
+			switch field {
+			case "NAME":
+				childConfigs[index].Name = value
+			case "URL":
+				childConfigs[index].URL = value
+			case "TIMEOUT":
+				if timeout, err := strconv.Atoi(value); err == nil {
+					childConfigs[index].Timeout = timeout
+				}
+			case "ROOTCAFILE":
+				childConfigs[index].RootCAFile = value
+			case "MAXSTALENESS":
+				if maxStaleness, err := strconv.Atoi(value); err == nil {
+					childConfigs[index].MaxStaleness = maxStaleness
+				}
+			case "CLIENTCERTFILE":
+				childConfigs[index].ClientCertFile = value
+			case "CLIENTKEYFILE":
+				childConfigs[index].ClientKeyFile = value
+			case "BEARERTOKEN":
+				childConfigs[index].BearerToken = value
+			case "BEARERTOKENFILE":
+				childConfigs[index].BearerTokenFile = value
+			case "USERNAME":
+				childConfigs[index].Username = value
+			case "PASSWORD":
+				childConfigs[index].Password = value
+			case "PASSWORDFILE":
+				childConfigs[index].PasswordFile = value
+			case "WEIGHT":
+				if weight, err := strconv.Atoi(value); err == nil && weight >= 0 {
+					childConfigs[index].Weight = &weight
+				}
 			}
-			return nil, fmt.Errorf("reading CA certificate %s: %w", c.RootCAFile, err)
 		}
+	}
 
-		caCertPool := x509.NewCertPool()
-		if !caCertPool.AppendCertsFromPEM(caCert) {
-			if Config.Prometheus.Enabled {
-				child_fetch_errors.WithLabelValues(c.Name).Inc()
+	// Add child configs in order
+	result := []ChildControllerConfig{}
+	for i := 0; i < len(childConfigs); i++ {
+		if childConfig, ok := childConfigs[i]; ok && childConfig.Name != "" && childConfig.URL != "" {
+			result = append(result, *childConfig)
+			if Config.Debug {
+				log.Printf("@D Loaded child config %d: %+v\n", i, *childConfig)
 			}
-			return nil, fmt.Errorf("failed to parse CA certificate from %s", c.RootCAFile)
 		}
+	}
+	return result
+}
 
-		tlsConfig.RootCAs = caCertPool
-		if Config.Debug {
-			log.Printf("@D Using custom CA certificate for child %s: %s\n", c.Name, c.RootCAFile)
+func newChildController(childConfig ChildControllerConfig) *ChildController {
+	timeout := 10 * time.Second
+	if childConfig.Timeout > 0 {
+		timeout = time.Duration(childConfig.Timeout) * time.Second
+	}
+	maxStaleness := 5 * time.Minute
+	if childConfig.MaxStaleness > 0 {
+		maxStaleness = time.Duration(childConfig.MaxStaleness) * time.Second
+	}
+	weight := DefaultWeight
+	if childConfig.Weight != nil {
+		weight = *childConfig.Weight
+	}
+	child := &ChildController{
+		Name:            childConfig.Name,
+		URL:             childConfig.URL,
+		Timeout:         timeout,
+		RootCAFile:      childConfig.RootCAFile,
+		MaxStaleness:    maxStaleness,
+		Weight:          weight,
+		BearerToken:     childConfig.BearerToken,
+		BearerTokenFile: childConfig.BearerTokenFile,
+		Username:        childConfig.Username,
+		Password:        childConfig.Password,
+		PasswordFile:    childConfig.PasswordFile,
+		source:          childConfig,
+	}
+	log.Printf("@I Registered child controller: %s (%s)\n", childConfig.Name, childConfig.URL)
+	if childConfig.RootCAFile != "" {
+		log.Printf("@I   Using CA certificate: %s\n", childConfig.RootCAFile)
+	}
+	if childConfig.ClientCertFile != "" || childConfig.ClientKeyFile != "" {
+		keyPair, err := newReloadingKeyPair(childConfig.ClientCertFile, childConfig.ClientKeyFile)
+		if err != nil {
+			// Kept, the files may appear later when the secret is issued
+			log.Printf("@W Client certificate for child %s: %v\n", childConfig.Name, err)
 		}
+		child.ClientCertificate = keyPair
+		log.Printf("@I   Using client certificate: %s\n", childConfig.ClientCertFile)
 	}
+	return child
+}
 
-	client := &http.Client{
-		Timeout: c.Timeout,
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
+// updateChildControllers returns the children for childConfigs. Children with an unchanged configuration are kept,
+// so their connections and last good configuration survive a reload of the configuration file.
+func updateChildControllers(childConfigs []ChildControllerConfig, current []*ChildController) []*ChildController {
+	children := make([]*ChildController, 0, len(childConfigs))
+	kept := make(map[*ChildController]bool)
+	for _, childConfig := range childConfigs {
+		var child *ChildController
+		for _, existing := range current {
+			if reflect.DeepEqual(existing.source, childConfig) {
+				child = existing
+				kept[child] = true
+				break
+			}
+		}
+		if child == nil {
+			child = newChildController(childConfig)
+		}
+		children = append(children, child)
 	}
+	for _, child := range current {
+		if !kept[child] {
+			log.Printf("@I Removed child controller: %s (%s)\n", child.Name, child.URL)
+		}
+	}
+	return children
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", c.URL, nil)
+func getChildControllers() []*ChildController {
+	if children := childControllers.Load(); children != nil {
+		return *children
+	}
+	return nil
+}
+
+func setChildControllers(children []*ChildController) {
+	childControllers.Store(&children)
+}
+
+// getViewURL returns the URL of a view on the child, the child is expected to define the same views
+func (c *ChildController) getViewURL(view string) string {
+	if view == "" {
+		return c.URL
+	}
+	return strings.TrimSuffix(c.URL, "/") + ViewsPath + view
+}
+
+// FetchConfiguration fetches the Traefik configuration, or a view of it, from a child controller
+func (c *ChildController) FetchConfiguration(ctx context.Context, view string) (*traefikconfig.Configuration, error) {
+	url := c.getViewURL(view)
+	if Config.Debug {
+		log.Printf("@D Fetching configuration from child controller: %s (%s)\n", c.Name, url)
+	}
+
+	client, err := c.getHTTPClient()
+	if err != nil {
+		if Config.Prometheus.Enabled {
+			child_fetch_errors.WithLabelValues(c.Name).Inc()
+		}
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		if Config.Prometheus.Enabled {
 			child_fetch_errors.WithLabelValues(c.Name).Inc()
 		}
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
+	if err := c.setAuthentication(req); err != nil {
+		if Config.Prometheus.Enabled {
+			child_fetch_errors.WithLabelValues(c.Name).Inc()
+		}
+		return nil, err
+	}
+	c.lock.Lock()
+	lastETag, lastConfig := c.lastETag[view], c.lastConfig[view]
+	c.lock.Unlock()
+	if lastETag != "" && lastConfig != nil {
+		req.Header.Set("If-None-Match", lastETag)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
 		if Config.Prometheus.Enabled {
 			child_fetch_errors.WithLabelValues(c.Name).Inc()
 		}
-		return nil, fmt.Errorf("fetching from %s: %w", c.URL, err)
+		return nil, fmt.Errorf("fetching from %s: %w", url, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && lastConfig != nil {
+		c.lock.Lock()
+		c.lastFetch[view] = time.Now()
+		c.lock.Unlock()
+		if Config.Prometheus.Enabled {
+			child_fetch_success.WithLabelValues(c.Name).Inc()
+		}
+		if Config.Debug {
+			log.Printf("@D Configuration from %s not modified\n", c.Name)
+		}
+		return lastConfig, nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		if Config.Prometheus.Enabled {
 			child_fetch_errors.WithLabelValues(c.Name).Inc()
 		}
-		return nil, fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, c.URL, string(body))
+		return nil, fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, url, string(body))
 	}
 
 	var config traefikconfig.Configuration
@@ -94,11 +291,19 @@ func (c *ChildController) FetchConfiguration(ctx context.Context) (*traefikconfi
 		if Config.Prometheus.Enabled {
 			child_fetch_errors.WithLabelValues(c.Name).Inc()
 		}
-		return nil, fmt.Errorf("decoding response from %s: %w", c.URL, err)
+		return nil, fmt.Errorf("decoding response from %s: %w", url, err)
 	}
 
-	c.lastFetch = time.Now()
-	c.lastConfig = &config
+	c.lock.Lock()
+	if c.lastConfig == nil {
+		c.lastFetch = make(map[string]time.Time)
+		c.lastConfig = make(map[string]*traefikconfig.Configuration)
+		c.lastETag = make(map[string]string)
+	}
+	c.lastFetch[view] = time.Now()
+	c.lastConfig[view] = &config
+	c.lastETag[view] = resp.Header.Get("ETag")
+	c.lock.Unlock()
 
 	if Config.Prometheus.Enabled {
 		child_fetch_success.WithLabelValues(c.Name).Inc()
@@ -111,21 +316,130 @@ func (c *ChildController) FetchConfiguration(ctx context.Context) (*traefikconfi
 	return &config, nil
 }
 
-// prefixConfigurationNames adds a namespace prefix to all service and router names
+// getHTTPClient returns the long lived client of the child, so connections are kept alive between fetches.
+// It is rebuilt when the CA or client certificate files change, connections made with the old files are closed.
+func (c *ChildController) getHTTPClient() (*http.Client, error) {
+	c.clientLock.Lock()
+	defer c.clientLock.Unlock()
+	files := []string{}
+	if c.RootCAFile != "" {
+		files = append(files, c.RootCAFile)
+	}
+	if c.ClientCertificate != nil {
+		files = append(files, c.ClientCertificate.CertFile, c.ClientCertificate.KeyFile)
+	}
+	modTime, err := getLatestModTime(files...)
+	if err != nil && c.httpClient != nil {
+		// Files being replaced, keep using the current client
+		return c.httpClient, nil
+	}
+	if c.httpClient != nil && modTime.Equal(c.tlsModTime) {
+		return c.httpClient, nil
+	}
+
+	// Create HTTP client with optional custom CA
+	tlsConfig := &tls.Config{}
+
+	if c.RootCAFile != "" {
+		caCert, err := os.ReadFile(c.RootCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificate %s: %w", c.RootCAFile, err)
+		}
+
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse CA certificate from %s", c.RootCAFile)
+		}
+
+		tlsConfig.RootCAs = caCertPool
+		if Config.Debug {
+			log.Printf("@D Using custom CA certificate for child %s: %s\n", c.Name, c.RootCAFile)
+		}
+	}
+
+	if c.ClientCertificate != nil {
+		tlsConfig.GetClientCertificate = c.ClientCertificate.GetClientCertificate
+	}
+
+	if c.httpClient != nil {
+		log.Printf("@I TLS files for child %s changed, reconnecting\n", c.Name)
+		c.httpClient.CloseIdleConnections()
+	}
+	// Responses are gzip compressed when the child supports it, the transport asks for and decodes it
+	c.httpClient = &http.Client{
+		Timeout: c.Timeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+	c.tlsModTime = modTime
+	return c.httpClient, nil
+}
+
+// setAuthentication adds the bearer token or basic auth credentials of the child to a request
+func (c *ChildController) setAuthentication(req *http.Request) error {
+	token := c.BearerToken
+	if c.BearerTokenFile != "" {
+		fileToken, err := readSecretFile(c.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("reading bearer token %s: %w", c.BearerTokenFile, err)
+		}
+		token = fileToken
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	if c.Username != "" {
+		password := c.Password
+		if c.PasswordFile != "" {
+			filePassword, err := readSecretFile(c.PasswordFile)
+			if err != nil {
+				return fmt.Errorf("reading password %s: %w", c.PasswordFile, err)
+			}
+			password = filePassword
+		}
+		req.SetBasicAuth(c.Username, password)
+	}
+	return nil
+}
+
+// prefixConfigurationNames adds a namespace prefix to all names in the configuration
+// and rewrites every reference to them, so the prefixed configuration stays consistent
 // to prevent naming conflicts when merging multiple configurations
 // Format: tooc-{namespace}-{original-name-without-tooc}
+// References to other providers (name@file) are left as they are.
 func prefixConfigurationNames(config *traefikconfig.Configuration, namespace string) *traefikconfig.Configuration {
 	if config == nil {
 		return nil
 	}
 
-	// Helper to reformat names: tooc-http-0 -> tooc-namespace-http-0
+	// Helper to reformat names: tooc-http-85564b8114 -> tooc-namespace-http-85564b8114
 	renameFn := func(name string) string {
+		// Leave cross provider references like name@file alone
+		if strings.Contains(name, ProviderSeparator) {
+			return name
+		}
 		// Remove "tooc-" prefix if present
 		name = strings.TrimPrefix(name, CommonName+"-")
 		// Add namespace: tooc-namespace-originalname
 		return fmt.Sprintf("%s-%s-%s", CommonName, namespace, name)
 	}
+	renameListFn := func(names []string) []string {
+		if names == nil {
+			return nil
+		}
+		renamed := make([]string, 0, len(names))
+		for _, name := range names {
+			renamed = append(renamed, renameFn(name))
+		}
+		return renamed
+	}
 
 	prefixed := &traefikconfig.Configuration{
 		HTTP: &traefikconfig.HTTPConfiguration{
@@ -135,72 +449,181 @@ func prefixConfigurationNames(config *traefikconfig.Configuration, namespace str
 			ServersTransports: make(map[string]*traefikconfig.ServersTransport),
 		},
 		TCP: &traefikconfig.TCPConfiguration{
-			Services:    make(map[string]*traefikconfig.TCPService),
-			Routers:     make(map[string]*traefikconfig.TCPRouter),
-			Middlewares: make(map[string]*traefikconfig.TCPMiddleware),
+			Services:          make(map[string]*traefikconfig.TCPService),
+			Routers:           make(map[string]*traefikconfig.TCPRouter),
+			Middlewares:       make(map[string]*traefikconfig.TCPMiddleware),
+			ServersTransports: make(map[string]*traefikconfig.TCPServersTransport),
+		},
+		UDP: &traefikconfig.UDPConfiguration{
+			Services: make(map[string]*traefikconfig.UDPService),
+			Routers:  make(map[string]*traefikconfig.UDPRouter),
 		},
 		TLS: config.TLS, // TLS config typically doesn't need prefixing
 	}
 
-	// Prefix HTTP services
+	// Prefix HTTP services and the services and transports they reference
 	if config.HTTP != nil {
 		for name, service := range config.HTTP.Services {
-			prefixedName := renameFn(name)
-			prefixed.HTTP.Services[prefixedName] = service
+			prefixed.HTTP.Services[renameFn(name)] = prefixHTTPService(service, renameFn)
 		}
 
-		// Prefix HTTP routers and update service references
+		// Prefix HTTP routers and update service and middleware references
 		for name, router := range config.HTTP.Routers {
-			prefixedName := renameFn(name)
 			prefixedRouter := *router // Copy router
 			if router.Service != "" {
 				prefixedRouter.Service = renameFn(router.Service)
 			}
-			prefixed.HTTP.Routers[prefixedName] = &prefixedRouter
+			prefixedRouter.Middlewares = renameListFn(router.Middlewares)
+			prefixed.HTTP.Routers[renameFn(name)] = &prefixedRouter
 		}
 
-		// Prefix HTTP middlewares
+		// Prefix HTTP middlewares, chains and error pages reference other objects
 		for name, middleware := range config.HTTP.Middlewares {
-			prefixedName := renameFn(name)
-			prefixed.HTTP.Middlewares[prefixedName] = middleware
+			prefixedMiddleware := *middleware // Copy middleware
+			if middleware.Chain != nil {
+				prefixedMiddleware.Chain = &traefikconfig.Chain{Middlewares: renameListFn(middleware.Chain.Middlewares)}
+			}
+			if middleware.Errors != nil {
+				errorPage := *middleware.Errors
+				if errorPage.Service != "" {
+					errorPage.Service = renameFn(errorPage.Service)
+				}
+				prefixedMiddleware.Errors = &errorPage
+			}
+			prefixed.HTTP.Middlewares[renameFn(name)] = &prefixedMiddleware
 		}
 
 		// Prefix HTTP servers transports
 		for name, transport := range config.HTTP.ServersTransports {
-			prefixedName := renameFn(name)
-			prefixed.HTTP.ServersTransports[prefixedName] = transport
+			prefixed.HTTP.ServersTransports[renameFn(name)] = transport
 		}
 	}
 
 	// Prefix TCP services
 	if config.TCP != nil {
 		for name, service := range config.TCP.Services {
-			prefixedName := renameFn(name)
-			prefixed.TCP.Services[prefixedName] = service
+			prefixedService := *service // Copy service
+			if service.LoadBalancer != nil {
+				loadBalancer := *service.LoadBalancer
+				if loadBalancer.ServersTransport != "" {
+					loadBalancer.ServersTransport = renameFn(loadBalancer.ServersTransport)
+				}
+				prefixedService.LoadBalancer = &loadBalancer
+			}
+			if service.Weighted != nil {
+				weighted := *service.Weighted
+				weighted.Services = make([]traefikconfig.TCPWRRService, 0, len(service.Weighted.Services))
+				for _, weightedService := range service.Weighted.Services {
+					weightedService.Name = renameFn(weightedService.Name)
+					weighted.Services = append(weighted.Services, weightedService)
+				}
+				prefixedService.Weighted = &weighted
+			}
+			prefixed.TCP.Services[renameFn(name)] = &prefixedService
 		}
 
-		// Prefix TCP routers and update service references
+		// Prefix TCP routers and update service and middleware references
 		for name, router := range config.TCP.Routers {
-			prefixedName := renameFn(name)
 			prefixedRouter := *router // Copy router
 			if router.Service != "" {
 				prefixedRouter.Service = renameFn(router.Service)
 			}
-			prefixed.TCP.Routers[prefixedName] = &prefixedRouter
+			prefixedRouter.Middlewares = renameListFn(router.Middlewares)
+			prefixed.TCP.Routers[renameFn(name)] = &prefixedRouter
 		}
 
 		// Prefix TCP middlewares
 		for name, middleware := range config.TCP.Middlewares {
-			prefixedName := renameFn(name)
-			prefixed.TCP.Middlewares[prefixedName] = middleware
+			prefixed.TCP.Middlewares[renameFn(name)] = middleware
+		}
+
+		// Prefix TCP servers transports
+		for name, transport := range config.TCP.ServersTransports {
+			prefixed.TCP.ServersTransports[renameFn(name)] = transport
+		}
+	}
+
+	// Prefix UDP services
+	if config.UDP != nil {
+		for name, service := range config.UDP.Services {
+			prefixedService := *service // Copy service
+			if service.Weighted != nil {
+				weighted := *service.Weighted
+				weighted.Services = make([]traefikconfig.UDPWRRService, 0, len(service.Weighted.Services))
+				for _, weightedService := range service.Weighted.Services {
+					weightedService.Name = renameFn(weightedService.Name)
+					weighted.Services = append(weighted.Services, weightedService)
+				}
+				prefixedService.Weighted = &weighted
+			}
+			prefixed.UDP.Services[renameFn(name)] = &prefixedService
+		}
+
+		// Prefix UDP routers and update service references
+		for name, router := range config.UDP.Routers {
+			prefixedRouter := *router // Copy router
+			if router.Service != "" {
+				prefixedRouter.Service = renameFn(router.Service)
+			}
+			prefixed.UDP.Routers[renameFn(name)] = &prefixedRouter
 		}
 	}
 
 	return prefixed
 }
 
-// mergeConfigurations combines multiple Traefik configurations into one
-func mergeConfigurations(configs ...*traefikconfig.Configuration) *traefikconfig.Configuration {
+// prefixHTTPService copies an HTTP service with the servers transport and the services it points to renamed
+func prefixHTTPService(service *traefikconfig.Service, renameFn func(string) string) *traefikconfig.Service {
+	prefixedService := *service // Copy service
+	if service.LoadBalancer != nil {
+		loadBalancer := *service.LoadBalancer
+		if loadBalancer.ServersTransport != "" {
+			loadBalancer.ServersTransport = renameFn(loadBalancer.ServersTransport)
+		}
+		prefixedService.LoadBalancer = &loadBalancer
+	}
+	if service.Weighted != nil {
+		weighted := *service.Weighted
+		weighted.Services = make([]traefikconfig.WRRService, 0, len(service.Weighted.Services))
+		for _, weightedService := range service.Weighted.Services {
+			weightedService.Name = renameFn(weightedService.Name)
+			weighted.Services = append(weighted.Services, weightedService)
+		}
+		prefixedService.Weighted = &weighted
+	}
+	if service.HighestRandomWeight != nil {
+		highestRandomWeight := *service.HighestRandomWeight
+		highestRandomWeight.Services = make([]traefikconfig.HRWService, 0, len(service.HighestRandomWeight.Services))
+		for _, weightedService := range service.HighestRandomWeight.Services {
+			weightedService.Name = renameFn(weightedService.Name)
+			highestRandomWeight.Services = append(highestRandomWeight.Services, weightedService)
+		}
+		prefixedService.HighestRandomWeight = &highestRandomWeight
+	}
+	if service.Mirroring != nil {
+		mirroring := *service.Mirroring
+		mirroring.Service = renameFn(mirroring.Service)
+		mirroring.Mirrors = make([]traefikconfig.MirrorService, 0, len(service.Mirroring.Mirrors))
+		for _, mirror := range service.Mirroring.Mirrors {
+			mirror.Name = renameFn(mirror.Name)
+			mirroring.Mirrors = append(mirroring.Mirrors, mirror)
+		}
+		prefixedService.Mirroring = &mirroring
+	}
+	if service.Failover != nil {
+		failover := *service.Failover
+		failover.Service = renameFn(failover.Service)
+		if failover.Fallback != "" {
+			failover.Fallback = renameFn(failover.Fallback)
+		}
+		prefixedService.Failover = &failover
+	}
+	return &prefixedService
+}
+
+// mergeConfigurations combines multiple Traefik configurations into one,
+// routers with the same rule in more than one source are resolved with the configured conflict policy
+func mergeConfigurations(view string, sources ...sourceConfiguration) *traefikconfig.Configuration {
 	merged := &traefikconfig.Configuration{
 		HTTP: &traefikconfig.HTTPConfiguration{
 			Services:          make(map[string]*traefikconfig.Service),
@@ -209,13 +632,19 @@ func mergeConfigurations(configs ...*traefikconfig.Configuration) *traefikconfig
 			ServersTransports: make(map[string]*traefikconfig.ServersTransport),
 		},
 		TCP: &traefikconfig.TCPConfiguration{
-			Services:    make(map[string]*traefikconfig.TCPService),
-			Routers:     make(map[string]*traefikconfig.TCPRouter),
-			Middlewares: make(map[string]*traefikconfig.TCPMiddleware),
+			Services:          make(map[string]*traefikconfig.TCPService),
+			Routers:           make(map[string]*traefikconfig.TCPRouter),
+			Middlewares:       make(map[string]*traefikconfig.TCPMiddleware),
+			ServersTransports: make(map[string]*traefikconfig.TCPServersTransport),
+		},
+		UDP: &traefikconfig.UDPConfiguration{
+			Services: make(map[string]*traefikconfig.UDPService),
+			Routers:  make(map[string]*traefikconfig.UDPRouter),
 		},
 	}
 
-	for _, config := range configs {
+	for _, source := range sources {
+		config := source.Config
 		if config == nil {
 			continue
 		}
@@ -247,37 +676,89 @@ func mergeConfigurations(configs ...*traefikconfig.Configuration) *traefikconfig
 			for name, middleware := range config.TCP.Middlewares {
 				merged.TCP.Middlewares[name] = middleware
 			}
+			for name, transport := range config.TCP.ServersTransports {
+				merged.TCP.ServersTransports[name] = transport
+			}
+		}
+
+		// Merge UDP
+		if config.UDP != nil {
+			for name, service := range config.UDP.Services {
+				merged.UDP.Services[name] = service
+			}
+			for name, router := range config.UDP.Routers {
+				merged.UDP.Routers[name] = router
+			}
 		}
 	}
 
+	resolveConflicts(merged, sources, Config.Aggregation.ConflictPolicy, view)
 	return merged
 }
 
-// GetAggregatedConfiguration fetches configurations from all child controllers and merges them
-func GetAggregatedConfiguration(ctx context.Context, children []ChildController, localConfig *traefikconfig.Configuration) (*traefikconfig.Configuration, error) {
-	configs := make([]*traefikconfig.Configuration, 0, len(children)+1)
+// GetConfiguration fetches the configuration from the child and falls back to the last good configuration
+// when the fetch fails, as long as it is not older than MaxStaleness.
+// This keeps the routes of a child in place during a short outage instead of removing them downstream.
+func (c *ChildController) GetConfiguration(ctx context.Context, view string) (*traefikconfig.Configuration, error) {
+	config, err := c.FetchConfiguration(ctx, view)
+	if err == nil {
+		if Config.Prometheus.Enabled && view == "" {
+			child_config_staleness.WithLabelValues(c.Name).Set(0)
+		}
+		return config, nil
+	}
+	c.lock.Lock()
+	lastFetch, lastConfig := c.lastFetch[view], c.lastConfig[view]
+	c.lock.Unlock()
+	if lastConfig == nil {
+		return nil, err
+	}
+	staleness := time.Since(lastFetch)
+	if staleness > c.MaxStaleness {
+		return nil, fmt.Errorf("%w, last good configuration from %v is older than %v", err, lastFetch.Format(time.RFC3339), c.MaxStaleness)
+	}
+	log.Printf("@W Failed to fetch configuration from child %s, serving configuration from %v ago: %v\n", c.Name, staleness.Round(time.Second), err)
+	if Config.Prometheus.Enabled && view == "" {
+		child_config_staleness.WithLabelValues(c.Name).Set(staleness.Seconds())
+	}
+	return lastConfig, nil
+}
+
+// GetAggregatedConfiguration fetches configurations (or the same view) from all child controllers in parallel and merges them
+func GetAggregatedConfiguration(ctx context.Context, children []*ChildController, localConfig *traefikconfig.Configuration, view string) (*traefikconfig.Configuration, error) {
+	configs := make([]sourceConfiguration, 0, len(children)+1)
 
 	// Add local configuration without additional prefix (already has CommonName prefix)
 	if localConfig != nil {
-		configs = append(configs, localConfig)
+		configs = append(configs, sourceConfiguration{Name: LocalSourceName, Config: localConfig, Weight: Config.Aggregation.LocalWeight})
 	}
 
-	// Fetch and prefix child configurations
-	for _, child := range children {
-		childConfig, err := child.FetchConfiguration(ctx)
-		if err != nil {
-			log.Printf("@W Failed to fetch configuration from child %s: %v\n", child.Name, err)
-			// Continue with other children instead of failing completely
-			continue
+	// Fetch and prefix child configurations, every child writes its own slot so the merge order stays fixed
+	childConfigs := make([]*traefikconfig.Configuration, len(children))
+	var wait sync.WaitGroup
+	for i, child := range children {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			childConfig, err := child.GetConfiguration(ctx, view)
+			if err != nil {
+				log.Printf("@W Failed to fetch configuration from child %s: %v\n", child.Name, err)
+				// Continue with other children instead of failing completely
+				return
+			}
+			childConfigs[i] = prefixConfigurationNames(childConfig, child.Name)
+		}()
+	}
+	wait.Wait()
+	for i, childConfig := range childConfigs {
+		if childConfig != nil {
+			configs = append(configs, sourceConfiguration{Name: children[i].Name, Config: childConfig, Weight: children[i].Weight})
 		}
-
-		prefixedConfig := prefixConfigurationNames(childConfig, child.Name)
-		configs = append(configs, prefixedConfig)
 	}
 
 	if len(configs) == 0 {
 		return nil, fmt.Errorf("no configurations available to merge")
 	}
 
-	return mergeConfigurations(configs...), nil
+	return mergeConfigurations(view, configs...), nil
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// Commands run instead of the server when given as the first argument, they use the same configuration.
+const commandsUsage = `Usage: traefik-out-of-cluster [command]
+
+Without a command the provider endpoint is served.
+
+Commands:
+  diff        Show the routers, services, ... that differ between two configurations, exits with 1 on differences
+  render      Print the configuration generated from manifest files, without a cluster
+  validate    Check the configuration and report every problem, exits with 1 on fatal problems
+  write-file  Write the configuration once for the Traefik file provider
+`
+
+// runCommand runs a command and returns the exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "diff":
+		return diffCommand(args[1:])
+	case "render":
+		return renderCommand(args[1:])
+	case "write-file":
+		return writeFileCommand(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(commandsUsage)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %v\n\n%v", args[0], commandsUsage)
+	return 2
+}
+
+func writeFileCommand(args []string) int {
+	flags := flag.NewFlagSet("write-file", flag.ContinueOnError)
+	writer := &fileWriter{}
+	flags.StringVar(&writer.Directory, "directory", Config.File.Directory, "Directory to write to (TOOC_FILE_DIRECTORY)")
+	flags.StringVar(&writer.Name, "name", Config.File.Name, "File name without extension (TOOC_FILE_NAME)")
+	flags.StringVar(&writer.Format, "format", Config.File.Format, "yaml or toml (TOOC_FILE_FORMAT)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if writer.Directory == "" {
+		writer.Directory = "."
+	}
+	if writer.Format != FileFormatYAML && writer.Format != FileFormatTOML {
+		fmt.Fprintf(os.Stderr, "Unknown file format %v, use %v or %v\n", writer.Format, FileFormatYAML, FileFormatTOML)
+		return 2
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	encoded, err := getEncodedConfiguration(ctx, "")
+	if err == nil {
+		err = writer.write(encoded)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing configuration: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// validateCommand prints the problems found in the configuration, it runs before anything connects to the cluster
+func validateCommand(problems []configProblem) int {
+	fatal := false
+	for _, problem := range problems {
+		level := "warning"
+		if problem.Fatal {
+			level = "error"
+			fatal = true
+		}
+		fmt.Printf("%v: %v\n", level, problem)
+	}
+	if fatal {
+		return 1
+	}
+	fmt.Printf("Configuration is valid (%d warnings)\n", len(problems))
+	return 0
+}
+
+// diffCommand compares two configurations, each a URL of a running instance, a file written by render or write-file, or - for stdin.
+// The exit code is 0 without differences, 1 with differences and 2 on errors, like diff.
+func diffCommand(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "Print the changes as JSON with the objects before and after")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: traefik-out-of-cluster diff [flags] from to\n\nfrom and to are URLs, JSON, YAML or TOML files or -.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	trees := []map[string]interface{}{}
+	for _, source := range flags.Args() {
+		tree, err := readConfigurationTree(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %v: %v\n", source, err)
+			return 2
+		}
+		trees = append(trees, tree)
+	}
+	changes, err := diffConfigurationTrees(trees[0], trees[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error comparing configurations: %v\n", err)
+		return 2
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(changes)
+	} else {
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readConfigurationTree reads a configuration as a generic tree, from a URL or a file decoded by its extension
+func readConfigurationTree(source string) (map[string]interface{}, error) {
+	var content []byte
+	var err error
+	switch {
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		httpClient := &http.Client{Timeout: 30 * time.Second}
+		response, err := httpClient.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %v", response.Status)
+		}
+		content, err = io.ReadAll(response.Body)
+	case source == "-":
+		content, err = io.ReadAll(os.Stdin)
+	default:
+		content, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tree := map[string]interface{}{}
+	if filepath.Ext(source) == "."+FileFormatTOML {
+		err = toml.Unmarshal(content, &tree)
+	} else {
+		// YAML is a superset of the JSON served and printed by render
+		err = yaml.Unmarshal(content, &tree)
+	}
+	return tree, err
+}
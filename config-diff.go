@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The last generated configurations are kept, so a change downstream can be traced back to what tooc served
+// and when. Configurations are compared on the JSON served to Traefik, named objects (routers, services,
+// middlewares, serversTransports, ...) are compared one by one.
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// ConfigurationChange is a named object that differs between two configurations
+type ConfigurationChange struct {
+	Protocol string          `json:"protocol"` // http, tcp or udp
+	Section  string          `json:"section"`  // routers, services, middlewares, serversTransports, ...
+	Name     string          `json:"name"`
+	Change   string          `json:"change"`
+	From     json.RawMessage `json:"from,omitempty"`
+	To       json.RawMessage `json:"to,omitempty"`
+}
+
+func (change ConfigurationChange) String() string {
+	sign := map[string]string{ChangeAdded: "+", ChangeRemoved: "-", ChangeModified: "~"}[change.Change]
+	return fmt.Sprintf("%v %v %v %v", sign, change.Protocol, change.Section, change.Name)
+}
+
+// HistoryEntry is a configuration kept in the history
+type HistoryEntry struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"` // First time the configuration was generated
+	ETag    string    `json:"etag"`
+	Routers int       `json:"routers"`
+	body    []byte
+}
+
+// ConfigurationDiff is the response of the diff endpoint
+type ConfigurationDiff struct {
+	From      *HistoryEntry         `json:"from,omitempty"`
+	To        *HistoryEntry         `json:"to,omitempty"`
+	Changes   []ConfigurationChange `json:"changes"`
+	Snapshots []HistoryEntry        `json:"snapshots"`
+}
+
+// configHistory keeps the last Size different configurations, oldest first
+type configHistory struct {
+	lock    sync.Mutex
+	entries []HistoryEntry
+	nextID  int
+}
+
+var history configHistory
+
+// record adds a configuration unless it is the same as the latest one
+func (history *configHistory) record(encoded *encodedConfiguration) {
+	if Config.History.Size <= 0 {
+		return
+	}
+	history.lock.Lock()
+	defer history.lock.Unlock()
+	if len(history.entries) > 0 && history.entries[len(history.entries)-1].ETag == encoded.ETag {
+		return
+	}
+	history.nextID++
+	entry := HistoryEntry{ID: history.nextID, Time: time.Now(), ETag: encoded.ETag, body: encoded.Body}
+	if encoded.Configuration != nil {
+		if encoded.Configuration.HTTP != nil {
+			entry.Routers += len(encoded.Configuration.HTTP.Routers)
+		}
+		if encoded.Configuration.TCP != nil {
+			entry.Routers += len(encoded.Configuration.TCP.Routers)
+		}
+		if encoded.Configuration.UDP != nil {
+			entry.Routers += len(encoded.Configuration.UDP.Routers)
+		}
+	}
+	history.entries = append(history.entries, entry)
+	if len(history.entries) > Config.History.Size {
+		history.entries = history.entries[len(history.entries)-Config.History.Size:]
+	}
+}
+
+// write records the aggregated configuration from the writer loop, only with child controllers.
+// Without children every build is recorded when its snapshot is stored.
+func (history *configHistory) write(encoded *encodedConfiguration) error {
+	if len(getChildControllers()) > 0 {
+		history.record(encoded)
+	}
+	return nil
+}
+
+func (history *configHistory) snapshots() []HistoryEntry {
+	history.lock.Lock()
+	defer history.lock.Unlock()
+	return append([]HistoryEntry{}, history.entries...)
+}
+
+// diff compares two entries by ID, 0 for from is the entry before to and 0 for to is the latest entry
+func (history *configHistory) diff(fromID int, toID int) (*ConfigurationDiff, error) {
+	result := &ConfigurationDiff{Snapshots: history.snapshots(), Changes: []ConfigurationChange{}}
+	find := func(id int) *HistoryEntry {
+		for i := range result.Snapshots {
+			if result.Snapshots[i].ID == id {
+				return &result.Snapshots[i]
+			}
+		}
+		return nil
+	}
+	if len(result.Snapshots) == 0 {
+		return result, nil
+	}
+	if toID == 0 {
+		toID = result.Snapshots[len(result.Snapshots)-1].ID
+	}
+	result.To = find(toID)
+	if result.To == nil {
+		return nil, fmt.Errorf("snapshot %d is not in the history", toID)
+	}
+	if fromID == 0 {
+		fromID = toID - 1
+	}
+	result.From = find(fromID)
+	if result.From == nil {
+		if fromID == toID-1 && result.To.ID == result.Snapshots[0].ID {
+			return result, nil // Nothing older is kept
+		}
+		return nil, fmt.Errorf("snapshot %d is not in the history", fromID)
+	}
+	var err error
+	result.Changes, err = diffConfigurationBodies(result.From.body, result.To.body)
+	return result, err
+}
+
+// diffConfigurationBodies compares two configurations encoded as JSON
+func diffConfigurationBodies(from []byte, to []byte) ([]ConfigurationChange, error) {
+	var fromTree, toTree map[string]interface{}
+	if err := json.Unmarshal(from, &fromTree); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &toTree); err != nil {
+		return nil, err
+	}
+	return diffConfigurationTrees(fromTree, toTree)
+}
+
+// diffConfigurationTrees compares configurations decoded to generic trees, from JSON, YAML or TOML.
+// Objects are compared on their JSON encoding, so numbers decoded to different types are still equal,
+// and nulls are dropped like in the files written as TOML.
+func diffConfigurationTrees(from map[string]interface{}, to map[string]interface{}) ([]ConfigurationChange, error) {
+	convertJSONNumbers(from)
+	convertJSONNumbers(to)
+	changes := []ConfigurationChange{}
+	for _, protocol := range []string{ConflictProtocolHTTP, ConflictProtocolTCP, ConflictProtocolUDP} {
+		fromSections, _ := from[protocol].(map[string]interface{})
+		toSections, _ := to[protocol].(map[string]interface{})
+		for _, section := range unionKeys(fromSections, toSections) {
+			fromObjects, _ := fromSections[section].(map[string]interface{})
+			toObjects, _ := toSections[section].(map[string]interface{})
+			for _, name := range unionKeys(fromObjects, toObjects) {
+				change := ConfigurationChange{Protocol: protocol, Section: section, Name: name}
+				fromObject, inFrom := fromObjects[name]
+				toObject, inTo := toObjects[name]
+				var err error
+				if inFrom {
+					if change.From, err = json.Marshal(fromObject); err != nil {
+						return nil, err
+					}
+				}
+				if inTo {
+					if change.To, err = json.Marshal(toObject); err != nil {
+						return nil, err
+					}
+				}
+				switch {
+				case !inFrom:
+					change.Change = ChangeAdded
+				case !inTo:
+					change.Change = ChangeRemoved
+				case string(change.From) != string(change.To):
+					change.Change = ChangeModified
+				default:
+					continue
+				}
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// unionKeys returns the keys of both maps once, sorted
+func unionKeys(first map[string]interface{}, second map[string]interface{}) []string {
+	keys := make(map[string]bool)
+	for key := range first {
+		keys[key] = true
+	}
+	for key := range second {
+		keys[key] = true
+	}
+	return sortedKeys(keys)
+}
+
+// DiffHandler serves the history and the changes between two snapshots, ?from=[id]&to=[id].
+// Without ids the latest change is shown.
+func DiffHandler(w http.ResponseWriter, r *http.Request) {
+	if Config.Prometheus.Enabled {
+		requests.WithLabelValues(r.URL.EscapedPath(), r.Method).Inc()
+	}
+	ids := []int{0, 0}
+	for i, parameter := range []string{"from", "to"} {
+		value := r.URL.Query().Get(parameter)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("@I %v %v %v %v - DiffHandler invalid %v\n", r.Method, r.URL.Path, r.RemoteAddr, 400, parameter)
+			http.Error(w, fmt.Sprintf("%v must be a snapshot id", parameter), http.StatusBadRequest)
+			return
+		}
+		ids[i] = id
+	}
+	result, err := history.diff(ids[0], ids[1])
+	if err != nil {
+		log.Printf("@I %v %v %v %v - DiffHandler %v\n", r.Method, r.URL.Path, r.RemoteAddr, 404, err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if Config.Debug || Config.Print.Ok {
+		log.Printf("@I %v %v %v %v - DiffHandler\n", r.Method, r.URL.Path, r.RemoteAddr, 200)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
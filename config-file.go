@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+const (
+	ConfigFileEnv = "TOOC_CONFIG_FILE" // YAML file with the same options as the TOOC_ environment variables
+)
+
+// readConfigFile reads the configuration file named by TOOC_CONFIG_FILE, if any.
+// Keys are the option names in lower or mixed case (cluster.ingress.address), lists like children
+// are lists of objects. Environment variables override the file.
+func readConfigFile(dynamicConfig *viper.Viper) (string, error) {
+	configFile := strings.TrimSpace(os.Getenv(ConfigFileEnv))
+	if configFile == "" {
+		return "", nil
+	}
+	dynamicConfig.SetConfigFile(configFile)
+	if err := dynamicConfig.ReadInConfig(); err != nil {
+		return configFile, err
+	}
+	log.Printf("@I Using configuration file %v\n", configFile)
+	return configFile, nil
+}
+
+// bindEnv binds every known key to its TOOC_ environment variable, so the variables take precedence over the file
+func bindEnv(dynamicConfig *viper.Viper) {
+	for _, key := range dynamicConfig.AllKeys() {
+		dynamicConfig.BindEnv(key, "TOOC_"+strings.ToUpper(strings.ReplaceAll(key, ".", "_")))
+	}
+}
+
+// watchConfigFile reloads children, ingress ports and entrypoint names when the configuration file changes.
+// A file mounted from a ConfigMap is replaced through a symlink, which is followed as well.
+// Other options only take effect on restart.
+func watchConfigFile(dynamicConfig *viper.Viper) {
+	dynamicConfig.OnConfigChange(func(event fsnotify.Event) {
+		bindEnv(dynamicConfig)
+		var reloaded ConfigType
+		if err := dynamicConfig.Unmarshal(&reloaded); err != nil {
+			log.Printf("@E Error reloading configuration file %v, keeping the current configuration: %v\n", event.Name, err)
+			return
+		}
+		reloaded.Children = getChildConfigsFromEnv(reloaded.Children)
+		reloaded.Views = getViewConfigsFromEnv(reloaded.Views)
+		if logConfigProblems(validateConfig(&reloaded)) {
+			log.Printf("@E Invalid configuration file %v, keeping the current configuration\n", event.Name)
+			return
+		}
+		log.Printf("@I Configuration file %v changed, reloading children, ingress ports and entrypoints\n", event.Name)
+		setChildControllers(updateChildControllers(reloaded.Children, getChildControllers()))
+		client.reloadConfig(&reloaded)
+	})
+	dynamicConfig.WatchConfig()
+}
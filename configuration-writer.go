@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// configurationWriter is an output the full configuration is pushed to, instead of being polled from MainHandler
+type configurationWriter interface {
+	// write stores the configuration, nothing is done when it is the one written last
+	write(encoded *encodedConfiguration) error
+}
+
+// runConfigurationWriter pushes the full configuration every interval when it changed. Between changes this only
+// compares the ETag of the snapshot, or fetches children with If-None-Match on an aggregator.
+func runConfigurationWriter(ctx context.Context, writer configurationWriter, name string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fetchContext, cancel := context.WithTimeout(ctx, 30*time.Second)
+		encoded, err := getEncodedConfiguration(fetchContext, "")
+		cancel()
+		if err == nil {
+			err = writer.write(encoded)
+		}
+		if err != nil {
+			log.Printf("@E Error writing configuration to %v: %v\n", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
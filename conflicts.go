@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ptypes "github.com/traefik/paerser/types"
+	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
+)
+
+// Routers from different sources (the local cluster and the children) with the same entrypoints and rule
+// are a conflict, Traefik would pick one of them without anyone noticing.
+// The policy decides what ends up in the merged configuration.
+const (
+	LocalSourceName         = "local"
+	ConflictPolicyFirstWins = "first-wins" // The source that exported the rule first keeps it while it still exports it
+	ConflictPolicyPriority  = "priority"   // Local first, then the children in configured order
+	ConflictPolicyReject    = "reject"     // All conflicting routers are dropped
+	ConflictPolicyCombine   = "combine"    // One router with a weighted service across all the sources
+	ConflictPolicyFailover  = "failover"   // One router with a failover service, the highest weight is the primary
+	ConflictProtocolHTTP    = "http"
+	ConflictProtocolTCP     = "tcp"
+	ConflictProtocolUDP     = "udp"
+	CombinedServiceName     = CommonName + "-combined"
+	DefaultWeight           = 1
+)
+
+// sourceConfiguration is a configuration to merge and the source it came from.
+// Weight is used for the services of the source when conflicting routers are combined.
+type sourceConfiguration struct {
+	Name   string
+	Config *traefikconfig.Configuration
+	Weight int
+}
+
+// RouterConflict is a rule exported by more than one source and how it was resolved
+type RouterConflict struct {
+	Protocol    string   `json:"protocol"`
+	EntryPoints []string `json:"entryPoints"`
+	Rule        string   `json:"rule,omitempty"`
+	Sources     []string `json:"sources"`
+	Routers     []string `json:"routers"`
+	Policy      string   `json:"policy"`
+	Winner      string   `json:"winner,omitempty"`
+	Service     string   `json:"service,omitempty"`
+}
+
+type conflictRouter struct {
+	Source string
+	Name   string
+	Weight int
+}
+
+// conflictMember is a service combined into the service of a conflict
+type conflictMember struct {
+	Source  string
+	Service string
+	Weight  int
+}
+
+type conflictGroup struct {
+	Protocol    string
+	EntryPoints []string
+	Rule        string
+	Routers     []conflictRouter
+}
+
+// conflictState is kept across merges for first-wins and to only log conflicts when they appear
+type conflictState struct {
+	lock      sync.Mutex
+	owners    map[string]string
+	conflicts map[string]RouterConflict
+}
+
+// The state of every view is separate, "" is the full configuration
+var (
+	aggregationConflictsLock sync.Mutex
+	aggregationConflicts     = make(map[string]*conflictState)
+)
+
+func getConflictState(view string) *conflictState {
+	aggregationConflictsLock.Lock()
+	defer aggregationConflictsLock.Unlock()
+	state, ok := aggregationConflicts[view]
+	if !ok {
+		state = &conflictState{owners: make(map[string]string)}
+		aggregationConflicts[view] = state
+	}
+	return state
+}
+
+func getConflictKey(protocol string, entryPoints []string, rule string) string {
+	sorted := slices.Clone(entryPoints)
+	sort.Strings(sorted)
+	return fmt.Sprintf("%v|%v|%v", protocol, strings.Join(sorted, ","), rule)
+}
+
+// getConflictGroups groups the routers of all sources by protocol, entrypoints and rule, in source order
+func getConflictGroups(sources []sourceConfiguration) (map[string]*conflictGroup, []string) {
+	groups := make(map[string]*conflictGroup)
+	keys := []string{}
+	add := func(protocol string, entryPoints []string, rule string, router conflictRouter) {
+		key := getConflictKey(protocol, entryPoints, rule)
+		group, ok := groups[key]
+		if !ok {
+			group = &conflictGroup{Protocol: protocol, EntryPoints: entryPoints, Rule: rule}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.Routers = append(group.Routers, router)
+	}
+	for _, source := range sources {
+		if source.Config == nil {
+			continue
+		}
+		weight := source.Weight
+		if source.Config.HTTP != nil {
+			for _, name := range sortedKeys(source.Config.HTTP.Routers) {
+				router := source.Config.HTTP.Routers[name]
+				add(ConflictProtocolHTTP, router.EntryPoints, router.Rule, conflictRouter{Source: source.Name, Name: name, Weight: weight})
+			}
+		}
+		if source.Config.TCP != nil {
+			for _, name := range sortedKeys(source.Config.TCP.Routers) {
+				router := source.Config.TCP.Routers[name]
+				add(ConflictProtocolTCP, router.EntryPoints, router.Rule, conflictRouter{Source: source.Name, Name: name, Weight: weight})
+			}
+		}
+		if source.Config.UDP != nil {
+			for _, name := range sortedKeys(source.Config.UDP.Routers) {
+				router := source.Config.UDP.Routers[name]
+				add(ConflictProtocolUDP, router.EntryPoints, "", conflictRouter{Source: source.Name, Name: name, Weight: weight})
+			}
+		}
+	}
+	return groups, keys
+}
+
+func sortedKeys[T any](items map[string]T) []string {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (group *conflictGroup) sources() []string {
+	sources := []string{}
+	for _, router := range group.Routers {
+		if !slices.Contains(sources, router.Source) {
+			sources = append(sources, router.Source)
+		}
+	}
+	return sources
+}
+
+// resolveConflicts applies the conflict policy to the merged configuration
+func resolveConflicts(merged *traefikconfig.Configuration, sources []sourceConfiguration, policy string, view string) []RouterConflict {
+	groups, keys := getConflictGroups(sources)
+	state := getConflictState(view)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	owners := make(map[string]string, len(keys))
+	conflicts := make(map[string]RouterConflict)
+	result := []RouterConflict{}
+	for _, key := range keys {
+		group := groups[key]
+		groupSources := group.sources()
+		// The owner is remembered for every rule, so first-wins still knows who was first once a conflict appears
+		owner, ok := state.owners[key]
+		if !ok || !slices.Contains(groupSources, owner) {
+			owner = groupSources[0]
+		}
+		owners[key] = owner
+		if len(groupSources) < 2 {
+			continue
+		}
+		conflict := RouterConflict{
+			Protocol:    group.Protocol,
+			EntryPoints: group.EntryPoints,
+			Rule:        group.Rule,
+			Sources:     groupSources,
+			Policy:      policy,
+		}
+		for _, router := range group.Routers {
+			conflict.Routers = append(conflict.Routers, router.Name)
+		}
+		switch policy {
+		case ConflictPolicyReject:
+			for _, router := range group.Routers {
+				deleteRouter(merged, group.Protocol, router.Name)
+			}
+		case ConflictPolicyCombine, ConflictPolicyFailover:
+			conflict.Service = combineRouters(merged, key, group, policy)
+			conflict.Winner = group.Routers[0].Source
+		default:
+			winner := groupSources[0]
+			if policy == ConflictPolicyFirstWins {
+				winner = owner
+			}
+			conflict.Winner = winner
+			for _, router := range group.Routers {
+				if router.Source != winner {
+					deleteRouter(merged, group.Protocol, router.Name)
+				}
+			}
+		}
+		if _, known := state.conflicts[key]; !known {
+			log.Printf("@W Conflicting %v rule %v on %v exported by %v in view %q, resolved with %v (winner: %v)\n",
+				conflict.Protocol, conflict.Rule, conflict.EntryPoints, conflict.Sources, view, policy, conflict.Winner)
+		}
+		conflicts[key] = conflict
+		result = append(result, conflict)
+	}
+	state.owners = owners
+	state.conflicts = conflicts
+	if Config.Prometheus.Enabled && view == "" {
+		router_conflicts_count.Set(float64(len(result)))
+	}
+	return result
+}
+
+func deleteRouter(merged *traefikconfig.Configuration, protocol string, name string) {
+	switch protocol {
+	case ConflictProtocolHTTP:
+		delete(merged.HTTP.Routers, name)
+	case ConflictProtocolTCP:
+		delete(merged.TCP.Routers, name)
+	case ConflictProtocolUDP:
+		delete(merged.UDP.Routers, name)
+	}
+}
+
+// getConflictMember returns the service a conflicting router points to and its weight.
+// A single entry weighted service with a weight is the weight label of the exported object,
+// it overrides the weight of the source and is replaced by the service it wraps.
+func getConflictMember(merged *traefikconfig.Configuration, protocol string, router conflictRouter) conflictMember {
+	member := conflictMember{Source: router.Source, Weight: router.Weight}
+	switch protocol {
+	case ConflictProtocolHTTP:
+		member.Service = merged.HTTP.Routers[router.Name].Service
+		if service, ok := merged.HTTP.Services[member.Service]; ok && service.Weighted != nil && len(service.Weighted.Services) == 1 && service.Weighted.Services[0].Weight != nil {
+			member = conflictMember{Source: router.Source, Service: service.Weighted.Services[0].Name, Weight: *service.Weighted.Services[0].Weight}
+		}
+	case ConflictProtocolTCP:
+		member.Service = merged.TCP.Routers[router.Name].Service
+		if service, ok := merged.TCP.Services[member.Service]; ok && service.Weighted != nil && len(service.Weighted.Services) == 1 && service.Weighted.Services[0].Weight != nil {
+			member = conflictMember{Source: router.Source, Service: service.Weighted.Services[0].Name, Weight: *service.Weighted.Services[0].Weight}
+		}
+	case ConflictProtocolUDP:
+		member.Service = merged.UDP.Routers[router.Name].Service
+		if service, ok := merged.UDP.Services[member.Service]; ok && service.Weighted != nil && len(service.Weighted.Services) == 1 && service.Weighted.Services[0].Weight != nil {
+			member = conflictMember{Source: router.Source, Service: service.Weighted.Services[0].Name, Weight: *service.Weighted.Services[0].Weight}
+		}
+	}
+	return member
+}
+
+// combineRouters keeps the first router of a conflict and points it to a service over the services of
+// all the conflicting routers. The combine policy gives a weighted service, the failover policy a chain of
+// failover services ordered by weight. Traefik only has failover for HTTP so TCP and UDP are always weighted.
+// Returns the name of the combined service.
+func combineRouters(merged *traefikconfig.Configuration, key string, group *conflictGroup, policy string) string {
+	serviceName := fmt.Sprintf("%v-%v", CombinedServiceName, getStableID(key))
+	kept := group.Routers[0].Name
+	members := []conflictMember{}
+	for _, router := range group.Routers {
+		members = append(members, getConflictMember(merged, group.Protocol, router))
+	}
+	switch group.Protocol {
+	case ConflictProtocolHTTP:
+		if policy == ConflictPolicyFailover {
+			appendFailoverServices(merged, serviceName, getRuleHost(group.Rule), members)
+		} else {
+			weighted := &traefikconfig.WeightedRoundRobin{}
+			for _, member := range members {
+				weighted.Services = append(weighted.Services, traefikconfig.WRRService{Name: member.Service, Weight: &member.Weight})
+			}
+			merged.HTTP.Services[serviceName] = &traefikconfig.Service{Weighted: weighted}
+		}
+		router := *merged.HTTP.Routers[kept]
+		router.Service = serviceName
+		merged.HTTP.Routers[kept] = &router
+	case ConflictProtocolTCP:
+		weighted := &traefikconfig.TCPWeightedRoundRobin{}
+		for _, member := range members {
+			weighted.Services = append(weighted.Services, traefikconfig.TCPWRRService{Name: member.Service, Weight: &member.Weight})
+		}
+		merged.TCP.Services[serviceName] = &traefikconfig.TCPService{Weighted: weighted}
+		router := *merged.TCP.Routers[kept]
+		router.Service = serviceName
+		merged.TCP.Routers[kept] = &router
+	case ConflictProtocolUDP:
+		weighted := &traefikconfig.UDPWeightedRoundRobin{}
+		for _, member := range members {
+			weighted.Services = append(weighted.Services, traefikconfig.UDPWRRService{Name: member.Service, Weight: &member.Weight})
+		}
+		merged.UDP.Services[serviceName] = &traefikconfig.UDPService{Weighted: weighted}
+		router := *merged.UDP.Routers[kept]
+		router.Service = serviceName
+		merged.UDP.Routers[kept] = &router
+	}
+	for _, router := range group.Routers[1:] {
+		deleteRouter(merged, group.Protocol, router.Name)
+	}
+	return serviceName
+}
+
+// appendFailoverServices chains failover services from the highest to the lowest weight,
+// a failover service only has a primary and a fallback so more than two members are nested.
+// Traefik only fails over when the health of the primary is known, when TOOC_AGGREGATION_HEALTHCHECK_PATH is set
+// every member gets its own copy of its load balancer with a health check for the conflicting host.
+// The original services are shared with every other router to the same ingress and are left as they are,
+// a failing check for one host must not take the backend down for all of them.
+func appendFailoverServices(merged *traefikconfig.Configuration, serviceName string, host string, members []conflictMember) {
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Weight > members[j].Weight
+	})
+	if Config.Aggregation.HealthCheck.Path != "" {
+		for i, member := range members {
+			service, ok := merged.HTTP.Services[member.Service]
+			if !ok || service.LoadBalancer == nil {
+				continue
+			}
+			// Copy, the service belongs to a snapshot of the source
+			loadBalancer := *service.LoadBalancer
+			loadBalancer.HealthCheck = &traefikconfig.ServerHealthCheck{
+				Path:     Config.Aggregation.HealthCheck.Path,
+				Interval: ptypes.Duration(time.Duration(Config.Aggregation.HealthCheck.Interval) * time.Second),
+				Hostname: getHealthCheckHostname(merged, &loadBalancer, host),
+			}
+			name := fmt.Sprintf("%v-%v", serviceName, member.Source)
+			if _, used := merged.HTTP.Services[name]; used {
+				// The same source exported the rule more than once
+				name = fmt.Sprintf("%v-%v-%v", serviceName, member.Source, i)
+			}
+			merged.HTTP.Services[name] = &traefikconfig.Service{LoadBalancer: &loadBalancer}
+			members[i].Service = name
+		}
+	}
+	fallback := members[len(members)-1].Service
+	for i := len(members) - 2; i >= 0; i-- {
+		name := serviceName
+		failover := &traefikconfig.Failover{Service: members[i].Service, Fallback: fallback}
+		if i > 0 {
+			// Nested failovers report their health to the parent
+			name = fmt.Sprintf("%v-fallback-%v", serviceName, i)
+			failover.HealthCheck = &traefikconfig.HealthCheck{}
+		}
+		merged.HTTP.Services[name] = &traefikconfig.Service{Failover: failover}
+		fallback = name
+	}
+}
+
+// getRuleHost returns the first hostname in the Host matchers of a rule, "" when it only has HostRegexp matchers
+func getRuleHost(rule string) string {
+	for _, matcher := range getHostMatchers(rule) {
+		if !matcher.regexp {
+			return matcher.host
+		}
+	}
+	return ""
+}
+
+// getHealthCheckHostname returns the Host header for a health check through the cluster ingress: the conflicting host,
+// or the internal hostname of a rewrite-hostname service which is what the cluster ingress knows
+func getHealthCheckHostname(merged *traefikconfig.Configuration, loadBalancer *traefikconfig.ServersLoadBalancer, host string) string {
+	if loadBalancer.ServersTransport != "" {
+		if transport, ok := merged.HTTP.ServersTransports[loadBalancer.ServersTransport]; ok && transport.ServerName != "" {
+			return transport.ServerName
+		}
+	}
+	return host
+}
+
+// getConflicts returns the conflicts found in the latest merge of a view sorted by key
+func getConflicts(view string) []RouterConflict {
+	state := getConflictState(view)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	conflicts := []RouterConflict{}
+	for _, key := range sortedKeys(state.conflicts) {
+		conflicts = append(conflicts, state.conflicts[key])
+	}
+	return conflicts
+}
+
+func ConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	if Config.Prometheus.Enabled {
+		requests.WithLabelValues(r.URL.EscapedPath(), r.Method).Inc()
+	}
+	if Config.Debug || Config.Print.Ok {
+		log.Printf("@I %v %v %v %v - ConflictsHandler\n", r.Method, r.URL.Path, r.RemoteAddr, 200)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(getConflicts(r.URL.Query().Get("view")))
+}
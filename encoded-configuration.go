@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
+)
+
+const (
+	ETagLength = 16 // Bytes of the content hash used as ETag
+)
+
+// encodedConfiguration is a configuration encoded once and served to every poll until it changes.
+// Map keys are sorted when encoding, so the same configuration always gives the same ETag.
+type encodedConfiguration struct {
+	Configuration *traefikconfig.Configuration
+	Body          []byte
+	Gzipped       []byte
+	ETag          string
+}
+
+func newEncodedConfiguration(configuration *traefikconfig.Configuration) (*encodedConfiguration, error) {
+	body, err := json.Marshal(configuration)
+	if err != nil {
+		return nil, err
+	}
+	body = append(body, '\n')
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	return &encodedConfiguration{
+		Configuration: configuration,
+		Body:          body,
+		Gzipped:       gzipped.Bytes(),
+		ETag:          `"` + hex.EncodeToString(sum[:ETagLength]) + `"`,
+	}, nil
+}
+
+// write sends the configuration, or 304 Not Modified when the client already has it (If-None-Match).
+// The body is gzip compressed when the client accepts it, Traefik and parent instances do.
+func (encoded *encodedConfiguration) write(w http.ResponseWriter, r *http.Request) int {
+	w.Header().Set("ETag", encoded.ETag)
+	w.Header().Add("Vary", "Accept-Encoding")
+	if matchesETag(r.Header.Get("If-None-Match"), encoded.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return http.StatusNotModified
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(encoded.Gzipped)
+		return http.StatusOK
+	}
+	w.Write(encoded.Body)
+	return http.StatusOK
+}
+
+func matchesETag(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
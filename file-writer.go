@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	FileFormatYAML = "yaml"
+	FileFormatTOML = "toml"
+)
+
+// fileWriter writes the configuration to a file for the Traefik file provider.
+// The file is replaced with a rename, so the file watcher of Traefik never reads a partly written file.
+type fileWriter struct {
+	Directory string
+	Name      string // File name without extension
+	Format    string // yaml or toml
+	etag      string // ETag of the configuration in the file, "" until the first write
+}
+
+func (writer *fileWriter) path() string {
+	return filepath.Join(writer.Directory, writer.Name+"."+writer.Format)
+}
+
+func (writer *fileWriter) write(encoded *encodedConfiguration) error {
+	if encoded.ETag == writer.etag {
+		return nil
+	}
+	content, err := encodeConfigurationFile(encoded, writer.Format)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(writer.path(), content); err != nil {
+		return err
+	}
+	log.Printf("@I Wrote configuration to %v\n", writer.path())
+	writer.etag = encoded.ETag
+	return nil
+}
+
+// encodeConfigurationFile converts the JSON served by MainHandler to YAML or TOML, so the file holds exactly
+// what the HTTP provider would get with the same field names
+func encodeConfigurationFile(encoded *encodedConfiguration, format string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(encoded.Body))
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	tree = convertJSONNumbers(tree)
+	if tree == nil {
+		tree = map[string]interface{}{}
+	}
+	switch format {
+	case FileFormatYAML:
+		return yaml.Marshal(tree)
+	case FileFormatTOML:
+		return toml.Marshal(tree)
+	}
+	return nil, fmt.Errorf("unknown file format %v, use %v or %v", format, FileFormatYAML, FileFormatTOML)
+}
+
+// convertJSONNumbers replaces json.Number with int64 or float64, the encoders would write them as strings.
+// Nulls are dropped, TOML has no null.
+func convertJSONNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if child == nil {
+				delete(value, key)
+				continue
+			}
+			value[key] = convertJSONNumbers(child)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = convertJSONNumbers(child)
+		}
+	case json.Number:
+		if number, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			return number
+		}
+		number, _ := value.Float64()
+		return number
+	}
+	return value
+}
+
+// writeFileAtomic writes content to a temporary file in the same directory and renames it in place of path
+func writeFileAtomic(path string, content []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // Only left when the rename did not happen
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Gateway API objects are read through the dynamic client so the CRDs only need to exist when the source is enabled.
+// Only the fields needed for exporting are decoded.
+// https://gateway-api.sigs.k8s.io/reference/spec/
+const (
+	GatewayGroup     = "gateway.networking.k8s.io"
+	GatewayKind      = "Gateway"
+	HTTPRouteKind    = "httproute"
+	TLSRouteKind     = "tlsroute"
+	TCPRouteKind     = "tcproute"
+	LableEntrypoint  = LablePrefix + "entrypoint" // Traefik entrypoint for routes that are not bound to a hostname
+	GatewayPathExact = "Exact"
+	GatewayPathRegex = "RegularExpression"
+	GatewayHTTP      = "HTTP"
+	GatewayHTTPS     = "HTTPS"
+)
+
+var (
+	GatewayResource   = schema.GroupVersionResource{Group: GatewayGroup, Version: "v1", Resource: "gateways"}
+	HTTPRouteResource = schema.GroupVersionResource{Group: GatewayGroup, Version: "v1", Resource: "httproutes"}
+	TLSRouteResource  = schema.GroupVersionResource{Group: GatewayGroup, Version: "v1alpha2", Resource: "tlsroutes"}
+	TCPRouteResource  = schema.GroupVersionResource{Group: GatewayGroup, Version: "v1alpha2", Resource: "tcproutes"}
+)
+
+type gatewayParentReference struct {
+	Group       *string `json:"group,omitempty"`
+	Kind        *string `json:"kind,omitempty"`
+	Namespace   *string `json:"namespace,omitempty"`
+	Name        string  `json:"name"`
+	SectionName *string `json:"sectionName,omitempty"`
+	Port        *int32  `json:"port,omitempty"`
+}
+
+type gatewayObject struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Listeners []struct {
+			Name     string `json:"name"`
+			Port     int32  `json:"port"`
+			Protocol string `json:"protocol"`
+		} `json:"listeners"`
+	} `json:"spec"`
+	Status struct {
+		Addresses []struct {
+			Type  *string `json:"type,omitempty"`
+			Value string  `json:"value"`
+		} `json:"addresses,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+type gatewayHTTPRoute struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		ParentRefs []gatewayParentReference `json:"parentRefs,omitempty"`
+		Hostnames  []string                 `json:"hostnames,omitempty"`
+		Rules      []struct {
+			Matches []gatewayHTTPRouteMatch `json:"matches,omitempty"`
+		} `json:"rules,omitempty"`
+	} `json:"spec"`
+}
+
+type gatewayHTTPRouteMatch struct {
+	Path *struct {
+		Type  *string `json:"type,omitempty"`
+		Value *string `json:"value,omitempty"`
+	} `json:"path,omitempty"`
+	Headers []struct {
+		Type  *string `json:"type,omitempty"`
+		Name  string  `json:"name"`
+		Value string  `json:"value"`
+	} `json:"headers,omitempty"`
+	Method *string `json:"method,omitempty"`
+}
+
+// gatewayL4Route covers both TLSRoute and TCPRoute, TCPRoute has no hostnames
+type gatewayL4Route struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		ParentRefs []gatewayParentReference `json:"parentRefs,omitempty"`
+		Hostnames  []string                 `json:"hostnames,omitempty"`
+	} `json:"spec"`
+}
+
+// startGatewayInformers registers the Gateway API informers, routes are filtered by the export label
+// while all gateways are watched as they carry the addresses for the routes.
+// Route kinds whose CRD is not installed (TLSRoute and TCPRoute are experimental) are skipped.
+func (kube *KubeClient) startGatewayInformers(dynamicClient dynamic.Interface) ([]cache.InformerSynced, error) {
+	routeFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 0, metav1.NamespaceAll,
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = fmt.Sprintf("%v=%v", LableExported, ExportedTrue)
+		})
+	gatewayFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
+	if !kube.resourceAvailable(GatewayResource) {
+		return nil, fmt.Errorf("gateway api source enabled but %v is not served by the cluster", GatewayResource)
+	}
+	informers := []cache.SharedIndexInformer{gatewayFactory.ForResource(GatewayResource).Informer()}
+	kube.gatewayLister = gatewayFactory.ForResource(GatewayResource).Lister()
+	for resource, lister := range map[schema.GroupVersionResource]*cache.GenericLister{
+		HTTPRouteResource: &kube.httpRouteLister,
+		TLSRouteResource:  &kube.tlsRouteLister,
+		TCPRouteResource:  &kube.tcpRouteLister,
+	} {
+		if !kube.resourceAvailable(resource) {
+			log.Printf("@W %v is not served by the cluster, not exporting %v\n", resource, resource.Resource)
+			continue
+		}
+		*lister = routeFactory.ForResource(resource).Lister()
+		informers = append(informers, routeFactory.ForResource(resource).Informer())
+	}
+	synced := []cache.InformerSynced{}
+	for _, informer := range informers {
+		_, err := informer.AddEventHandler(kube.rebuildEventHandler())
+		if err != nil {
+			return nil, err
+		}
+		synced = append(synced, informer.HasSynced)
+	}
+	gatewayFactory.Start(kube.context.Done())
+	routeFactory.Start(kube.context.Done())
+	return synced, nil
+}
+
+// resourceAvailable checks with discovery if the API server serves a resource
+func (kube *KubeClient) resourceAvailable(resource schema.GroupVersionResource) bool {
+	resources, err := kube.client.Discovery().ServerResourcesForGroupVersion(resource.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+	for _, apiResource := range resources.APIResources {
+		if apiResource.Name == resource.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// listDynamicObjects lists objects from a dynamic lister and decodes them into T, objects that fail to decode are skipped.
+// A nil lister (resource not served) gives an empty list.
+func listDynamicObjects[T any](lister cache.GenericLister) ([]T, error) {
+	if lister == nil {
+		return nil, nil
+	}
+	objects, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0, len(objects))
+	for _, object := range objects {
+		content, ok := object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		var decoded T
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content.Object, &decoded); err != nil {
+			log.Printf("@W listDynamicObjects: unable to decode %v %v/%v: %v\n", content.GetKind(), content.GetNamespace(), content.GetName(), err)
+			continue
+		}
+		result = append(result, decoded)
+	}
+	return result, nil
+}
+
+// getGatewayAddresses finds the addresses for a route from the status of its parent gateways.
+// The configured ingress address takes precedence like it does for ingresses.
+func getGatewayAddresses(gateways map[string]*gatewayObject, namespace string, parents []gatewayParentReference) []string {
+	statusAddresses := []string{}
+	for _, parent := range parents {
+		if !isGatewayParent(parent) {
+			continue
+		}
+		parentNamespace := namespace
+		if parent.Namespace != nil {
+			parentNamespace = *parent.Namespace
+		}
+		gateway, ok := gateways[parentNamespace+"/"+parent.Name]
+		if !ok {
+			continue
+		}
+		for _, address := range gateway.Status.Addresses {
+			statusAddresses = append(statusAddresses, address.Value)
+		}
+	}
+	return getLoadBalancerAddresses(statusAddresses)
+}
+
+// getGatewayListenerPort returns the port of the listener a route is attached to, or 0 if it can not be determined
+func getGatewayListenerPort(gateways map[string]*gatewayObject, namespace string, parents []gatewayParentReference) int32 {
+	for _, parent := range parents {
+		if !isGatewayParent(parent) {
+			continue
+		}
+		if parent.Port != nil {
+			return *parent.Port
+		}
+		parentNamespace := namespace
+		if parent.Namespace != nil {
+			parentNamespace = *parent.Namespace
+		}
+		gateway, ok := gateways[parentNamespace+"/"+parent.Name]
+		if !ok || parent.SectionName == nil {
+			continue
+		}
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.Name == *parent.SectionName {
+				return listener.Port
+			}
+		}
+	}
+	return 0
+}
+
+// getGatewayListenerPorts returns the ports of the HTTP and HTTPS listeners an HTTPRoute is attached to,
+// a route without a sectionName or port is attached to every listener of its gateway. Unknown ports are empty.
+func getGatewayListenerPorts(gateways map[string]*gatewayObject, namespace string, parents []gatewayParentReference) servicePorts {
+	ports := servicePorts{}
+	for _, parent := range parents {
+		if !isGatewayParent(parent) {
+			continue
+		}
+		parentNamespace := namespace
+		if parent.Namespace != nil {
+			parentNamespace = *parent.Namespace
+		}
+		gateway, ok := gateways[parentNamespace+"/"+parent.Name]
+		if !ok {
+			continue
+		}
+		for _, listener := range gateway.Spec.Listeners {
+			if (parent.SectionName != nil && listener.Name != *parent.SectionName) || (parent.Port != nil && listener.Port != *parent.Port) {
+				continue
+			}
+			if listener.Protocol == GatewayHTTP && ports.HTTP == "" {
+				ports.HTTP = strconv.Itoa(int(listener.Port))
+			} else if listener.Protocol == GatewayHTTPS && ports.HTTPS == "" {
+				ports.HTTPS = strconv.Itoa(int(listener.Port))
+			}
+		}
+	}
+	return ports
+}
+
+// isGatewayParent reports whether a parent reference is a Gateway, group and kind default to it
+func isGatewayParent(parent gatewayParentReference) bool {
+	if parent.Group != nil && *parent.Group != GatewayGroup {
+		return false
+	}
+	return parent.Kind == nil || *parent.Kind == GatewayKind
+}
+
+// getHTTPRouteMatcher translates an HTTPRoute match into a Traefik matcher and the priority it adds to the router.
+// Paths are prioritised like ingress paths, every header or method match adds one on top.
+// Values are quoted with backticks in the rule, so a value containing one can not be translated.
+func getHTTPRouteMatcher(match gatewayHTTPRouteMatch) (routeMatcher, error) {
+	values := []string{}
+	if match.Path != nil && match.Path.Value != nil {
+		values = append(values, *match.Path.Value)
+	}
+	for _, header := range match.Headers {
+		values = append(values, header.Name, header.Value)
+	}
+	if match.Method != nil {
+		values = append(values, *match.Method)
+	}
+	for _, value := range values {
+		if strings.Contains(value, "`") {
+			return routeMatcher{}, fmt.Errorf("%q contains a backtick, which can not be quoted in a Traefik rule", value)
+		}
+	}
+	matchers := []string{}
+	priority := 0
+	if match.Path != nil && match.Path.Value != nil {
+		pathType := "PathPrefix"
+		if match.Path.Type != nil {
+			pathType = *match.Path.Type
+		}
+		value := *match.Path.Value
+		switch pathType {
+		case GatewayPathExact:
+			matchers = append(matchers, fmt.Sprintf("Path(`%v`)", value))
+			priority += 2*len(value) + 1
+		case GatewayPathRegex:
+			matchers = append(matchers, fmt.Sprintf("PathRegexp(`%v`)", value))
+			priority += 2 * len(value)
+		default:
+			if value != "" && value != "/" {
+				matchers = append(matchers, fmt.Sprintf("PathPrefix(`%v`)", value))
+				priority += 2 * len(value)
+			}
+		}
+	}
+	for _, header := range match.Headers {
+		if header.Type != nil && *header.Type == GatewayPathRegex {
+			matchers = append(matchers, fmt.Sprintf("HeaderRegexp(`%v`, `%v`)", header.Name, header.Value))
+		} else {
+			matchers = append(matchers, fmt.Sprintf("Header(`%v`, `%v`)", header.Name, header.Value))
+		}
+		priority += 1
+	}
+	if match.Method != nil {
+		matchers = append(matchers, fmt.Sprintf("Method(`%v`)", *match.Method))
+		priority += 1
+	}
+	return routeMatcher{Rule: strings.Join(matchers, " && "), Priority: priority}, nil
+}
+
+// appendGatewayRoutes adds routers for exported HTTPRoute, TLSRoute and TCPRoute objects
+func (kube *KubeClient) appendGatewayRoutes(traefikConfig *configBuilder) (int, error) {
+	gatewayList, err := listDynamicObjects[gatewayObject](kube.gatewayLister)
+	if err != nil {
+		return 0, err
+	}
+	gateways := make(map[string]*gatewayObject, len(gatewayList))
+	for i := range gatewayList {
+		gateways[gatewayList[i].Namespace+"/"+gatewayList[i].Name] = &gatewayList[i]
+	}
+	httpRoutes, err := listDynamicObjects[gatewayHTTPRoute](kube.httpRouteLister)
+	if err != nil {
+		return 0, err
+	}
+	tlsRoutes, err := listDynamicObjects[gatewayL4Route](kube.tlsRouteLister)
+	if err != nil {
+		return 0, err
+	}
+	tcpRoutes, err := listDynamicObjects[gatewayL4Route](kube.tcpRouteLister)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(httpRoutes, func(i, j int) bool {
+		return httpRoutes[i].Namespace+"/"+httpRoutes[i].Name < httpRoutes[j].Namespace+"/"+httpRoutes[j].Name
+	})
+	sortL4Routes(tlsRoutes)
+	sortL4Routes(tcpRoutes)
+	if Config.Debug {
+		log.Printf("@D appendGatewayRoutes: found %v gateways, %v httproutes, %v tlsroutes, %v tcproutes\n", len(gateways), len(httpRoutes), len(tlsRoutes), len(tcpRoutes))
+	}
+
+	total_rules := 0
+	broken := map[string]int{HTTPRouteKind: 0, TLSRouteKind: 0, TCPRouteKind: 0}
+	for _, route := range httpRoutes {
+		if !traefikConfig.includes(&route) {
+			continue
+		}
+		addresses := getGatewayAddresses(gateways, route.Namespace, route.Spec.ParentRefs)
+		if len(addresses) == 0 || len(route.Spec.Hostnames) == 0 {
+			log.Printf("@W appendGatewayRoutes: httproute %v/%v has no gateway address or hostnames, skipping\n", route.Namespace, route.Name)
+			broken[HTTPRouteKind] += 1
+			continue
+		}
+		matchers := []routeMatcher{}
+		var matchErr error
+		for _, rule := range route.Spec.Rules {
+			if len(rule.Matches) == 0 {
+				matchers = append(matchers, routeMatcher{})
+			}
+			for _, match := range rule.Matches {
+				matcher, err := getHTTPRouteMatcher(match)
+				if err != nil {
+					matchErr = err
+					break
+				}
+				matchers = append(matchers, matcher)
+			}
+		}
+		if matchErr != nil {
+			log.Printf("@W appendGatewayRoutes: httproute %v/%v has a match that can not be translated, skipping: %v\n", route.Namespace, route.Name, matchErr)
+			broken[HTTPRouteKind] += 1
+			continue
+		}
+		if len(matchers) == 0 {
+			matchers = append(matchers, routeMatcher{})
+		}
+		rules := make([]exportedRule, 0, len(route.Spec.Hostnames))
+		for _, hostname := range route.Spec.Hostnames {
+			rules = append(rules, exportedRule{Host: hostname, Matchers: matchers})
+		}
+		name := fmt.Sprintf("%v-%v-%v-%v", CommonName, route.Namespace, HTTPRouteKind, route.Name)
+		// Backends are the listeners of the parent gateways, the ingress ports when they are not known
+		ports := getGatewayListenerPorts(gateways, route.Namespace, route.Spec.ParentRefs)
+		created, err := kube.appendHTTPRouters(traefikConfig, name, &route, addresses, ports, rules)
+		if err != nil {
+			log.Printf("@W appendGatewayRoutes: httproute %v/%v is not exported: %v\n", route.Namespace, route.Name, err)
+			broken[HTTPRouteKind] += 1
+			continue
+		}
+		total_rules += created
+	}
+	for _, route := range tlsRoutes {
+		if !traefikConfig.includes(&route) {
+			continue
+		}
+		addresses := getGatewayAddresses(gateways, route.Namespace, route.Spec.ParentRefs)
+		if len(addresses) == 0 || len(route.Spec.Hostnames) == 0 {
+			log.Printf("@W appendGatewayRoutes: tlsroute %v/%v has no gateway address or hostnames, skipping\n", route.Namespace, route.Name)
+			broken[TLSRouteKind] += 1
+			continue
+		}
+		name := fmt.Sprintf("%v-%v-%v-%v", CommonName, route.Namespace, TLSRouteKind, route.Name)
+		middlewares, err := kube.getAppendTCPMiddlewares(traefikConfig, name, &route)
+		if err != nil {
+			log.Printf("@W appendGatewayRoutes: tlsroute %v/%v is not exported: %v\n", route.Namespace, route.Name, err)
+			broken[TLSRouteKind] += 1
+			continue
+		}
+		// Passthrough goes to the port of the parent listener, the HTTPS port when it is not known
+		serviceName := name
+		if port := getGatewayListenerPort(gateways, route.Namespace, route.Spec.ParentRefs); port != 0 {
+			traefikConfig.TCP.Services[serviceName] = &traefikconfig.TCPService{
+				LoadBalancer: &traefikconfig.TCPServersLoadBalancer{
+					Servers: getTCPServers(addresses, port),
+				}}
+		} else {
+			serviceName = kube.getAppendServiceNames(traefikConfig, addresses, "").TCPServiceName
+		}
+		for id, hostname := range route.Spec.Hostnames {
+			sniRule := getHostSNIMatcher(hostname)
+			traefikConfig.TCP.Routers[fmt.Sprintf("%v-%v", name, id)] = &traefikconfig.TCPRouter{
+				EntryPoints: []string{traefikConfig.httpsEntrypoint()},
+				Rule:        sniRule,
+				Priority:    getHostPriority(isWildcardHost(hostname), sniRule),
+				Middlewares: middlewares,
+				Service:     serviceName,
+				TLS:         &traefikconfig.RouterTCPTLSConfig{Passthrough: true},
+			}
+			total_rules += 1
+		}
+	}
+	for _, route := range tcpRoutes {
+		if !traefikConfig.includes(&route) {
+			continue
+		}
+		addresses := getGatewayAddresses(gateways, route.Namespace, route.Spec.ParentRefs)
+		port := getGatewayListenerPort(gateways, route.Namespace, route.Spec.ParentRefs)
+		entrypoint, _ := getOption(&route, LableEntrypoint)
+		if len(addresses) == 0 || port == 0 || entrypoint == "" {
+			log.Printf("@W appendGatewayRoutes: tcproute %v/%v needs a gateway address, a listener port and the %v label, skipping\n", route.Namespace, route.Name, LableEntrypoint)
+			broken[TCPRouteKind] += 1
+			continue
+		}
+		name := fmt.Sprintf("%v-%v-%v-%v", CommonName, route.Namespace, TCPRouteKind, route.Name)
+		middlewares, err := kube.getAppendTCPMiddlewares(traefikConfig, name, &route)
+		if err != nil {
+			log.Printf("@W appendGatewayRoutes: tcproute %v/%v is not exported: %v\n", route.Namespace, route.Name, err)
+			broken[TCPRouteKind] += 1
+			continue
+		}
+		traefikConfig.TCP.Services[name] = &traefikconfig.TCPService{
+			LoadBalancer: &traefikconfig.TCPServersLoadBalancer{
+				Servers: getTCPServers(addresses, port),
+			}}
+		traefikConfig.TCP.Routers[name] = &traefikconfig.TCPRouter{
+			EntryPoints: []string{entrypoint},
+			Rule:        "HostSNI(`*`)",
+			Middlewares: middlewares,
+			Service:     name,
+		}
+		total_rules += 1
+	}
+	if traefikConfig.reportMetrics() {
+		exported_gateway_routes_count.WithLabelValues(HTTPRouteKind).Set(float64(len(httpRoutes)))
+		exported_gateway_routes_count.WithLabelValues(TLSRouteKind).Set(float64(len(tlsRoutes)))
+		exported_gateway_routes_count.WithLabelValues(TCPRouteKind).Set(float64(len(tcpRoutes)))
+		for kind, count := range broken {
+			broken_gateway_routes_count.WithLabelValues(kind).Set(float64(count))
+		}
+	}
+	return total_rules, nil
+}
+
+func sortL4Routes(routes []gatewayL4Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Namespace+"/"+routes[i].Name < routes[j].Namespace+"/"+routes[j].Name
+	})
+}
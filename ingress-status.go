@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// The owners of an exported ingress see what was made of it with kubectl describe: Kubernetes Events when
+// the export fails or changes, and optionally the status annotation with the routers and hosts generated.
+const (
+	LableStatus             = LablePrefix + "status" // Written by tooc, JSON of ingressStatus
+	ReasonExported          = "Exported"
+	ReasonNoAddress         = "NoLoadBalancerAddress"
+	ReasonNoHost            = "NoHost"
+	ReasonUnsupportedSSL    = "UnsupportedSSLType"
+	ReasonInvalidMiddleware = "InvalidMiddleware"
+	StatusAnnotateTimeout   = 10 * time.Second
+	StatusEventsRoutersMax  = 10 // Routers named in an Exported event, the annotation has all of them
+)
+
+// ingressStatus is the result of exporting one ingress in the full build
+type ingressStatus struct {
+	Routers  []string        `json:"routers,omitempty"`
+	Hosts    []string        `json:"hosts,omitempty"`
+	Errors   []string        `json:"errors,omitempty"`
+	failures []statusFailure // Errors with the reason of their event
+	ingress  *networkingv1.Ingress
+}
+
+type statusFailure struct {
+	Reason  string
+	Message string
+}
+
+// ingressStatus returns the status to fill in for an exported object, nil for other objects than ingresses
+// and in view builds. The methods of ingressStatus do nothing on nil.
+func (config *configBuilder) ingressStatus(object metav1.Object) *ingressStatus {
+	ingress, ok := object.(*networkingv1.Ingress)
+	if !ok || config.statuses == nil {
+		return nil
+	}
+	key := ingress.Namespace + "/" + ingress.Name
+	status, found := config.statuses[key]
+	if !found {
+		status = &ingressStatus{ingress: ingress}
+		config.statuses[key] = status
+	}
+	return status
+}
+
+func (status *ingressStatus) addRouter(name string) {
+	if status != nil {
+		status.Routers = append(status.Routers, name)
+	}
+}
+
+func (status *ingressStatus) addHost(host string) {
+	if status != nil && !slices.Contains(status.Hosts, host) {
+		status.Hosts = append(status.Hosts, host)
+	}
+}
+
+// fail adds an error, the same error for several rules is only added once
+func (status *ingressStatus) fail(reason string, message string) {
+	if status != nil && !slices.Contains(status.Errors, message) {
+		status.Errors = append(status.Errors, message)
+		status.failures = append(status.failures, statusFailure{Reason: reason, Message: message})
+	}
+}
+
+// statusPublisher publishes the statuses of the latest build with its own worker,
+// so a slow API server never holds up a build
+type statusPublisher struct {
+	client    kubernetes.Interface
+	recorder  record.EventRecorder
+	pending   atomic.Pointer[map[string]*ingressStatus]
+	changes   chan struct{}
+	published map[string]*ingressStatus // Last published status of every ingress, only used by the worker
+	started   bool                      // The statuses of the first build were published
+}
+
+func newStatusPublisher(ctx context.Context, client kubernetes.Interface) *statusPublisher {
+	publisher := &statusPublisher{
+		client:    client,
+		changes:   make(chan struct{}, 1),
+		published: make(map[string]*ingressStatus),
+	}
+	if Config.Status.Events {
+		broadcaster := record.NewBroadcaster(record.WithContext(ctx))
+		broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+		publisher.recorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: CommonName})
+	}
+	go publisher.worker(ctx)
+	return publisher
+}
+
+// publish queues the statuses of a build, statuses of builds that were not published yet are replaced
+func (publisher *statusPublisher) publish(statuses map[string]*ingressStatus) {
+	publisher.pending.Store(&statuses)
+	select {
+	case publisher.changes <- struct{}{}:
+	default:
+	}
+}
+
+func (publisher *statusPublisher) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-publisher.changes:
+			if statuses := publisher.pending.Swap(nil); statuses != nil {
+				publisher.update(ctx, *statuses)
+			}
+		}
+	}
+}
+
+func (publisher *statusPublisher) update(ctx context.Context, statuses map[string]*ingressStatus) {
+	for _, key := range sortedKeys(statuses) {
+		status := statuses[key]
+		if publisher.recorder != nil {
+			publisher.recordEvents(status, publisher.published[key])
+		}
+		if Config.Status.Annotation {
+			if err := publisher.annotate(ctx, status); err != nil {
+				log.Printf("@W Unable to write %v on ingress %v: %v\n", LableStatus, key, err)
+			}
+		} else if _, found := status.ingress.Annotations[LableStatus]; found {
+			publisher.removeAnnotation(ctx, key, status.ingress)
+		}
+		publisher.published[key] = status
+	}
+	for key, last := range publisher.published {
+		if _, found := statuses[key]; found {
+			continue
+		}
+		// No longer exported, the annotation written for it is removed
+		if _, found := last.ingress.Annotations[LableStatus]; found || Config.Status.Annotation {
+			publisher.removeAnnotation(ctx, key, last.ingress)
+		}
+		delete(publisher.published, key)
+	}
+	publisher.started = true
+}
+
+// recordEvents records a warning for every new error, and when the routers change or the errors are gone.
+// Ingresses that are fine on start get no event, so a restart does not repeat them for every ingress.
+func (publisher *statusPublisher) recordEvents(status *ingressStatus, last *ingressStatus) {
+	for _, failure := range status.failures {
+		if last == nil || !slices.Contains(last.Errors, failure.Message) {
+			publisher.recorder.Event(status.ingress, corev1.EventTypeWarning, failure.Reason, failure.Message)
+		}
+	}
+	if len(status.Errors) > 0 || len(status.Routers) == 0 || !publisher.started {
+		return
+	}
+	if last == nil || len(last.Errors) > 0 || !slices.Equal(last.Routers, status.Routers) {
+		routers := status.Routers
+		if len(routers) > StatusEventsRoutersMax {
+			routers = routers[:StatusEventsRoutersMax]
+		}
+		publisher.recorder.Eventf(status.ingress, corev1.EventTypeNormal, ReasonExported, "Exported %v as %d routers %v", status.Hosts, len(status.Routers), routers)
+	}
+}
+
+// annotate writes the status annotation when it differs from the one on the ingress.
+// The patch updates the ingress and causes one more build, which finds the annotation up to date.
+func (publisher *statusPublisher) annotate(ctx context.Context, status *ingressStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	if status.ingress.Annotations[LableStatus] == string(value) {
+		return nil
+	}
+	return publisher.patchAnnotation(ctx, status.ingress, string(value))
+}
+
+// removeAnnotation removes the status annotation from an ingress that is no longer exported, or when the
+// annotation is disabled. Ingresses that were deleted are skipped.
+func (publisher *statusPublisher) removeAnnotation(ctx context.Context, key string, ingress *networkingv1.Ingress) {
+	if err := publisher.patchAnnotation(ctx, ingress, nil); err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("@W Unable to remove %v from ingress %v: %v\n", LableStatus, key, err)
+	}
+}
+
+// patchAnnotation sets the status annotation, a nil value removes it
+func (publisher *statusPublisher) patchAnnotation(ctx context.Context, ingress *networkingv1.Ingress, value interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{LableStatus: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, StatusAnnotateTimeout)
+	defer cancel()
+	_, err = publisher.client.NetworkingV1().Ingresses(ingress.Namespace).Patch(ctx, ingress.Name,
+		types.MergePatchType, patch, metav1.PatchOptions{FieldManager: CommonName})
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadingKeyPair is a certificate and key loaded from files that are reloaded when they change,
+// so certificates rotated by cert-manager in a mounted secret are picked up without a restart.
+type reloadingKeyPair struct {
+	CertFile    string
+	KeyFile     string
+	lock        sync.Mutex
+	modTime     time.Time
+	certificate *tls.Certificate
+}
+
+func newReloadingKeyPair(certFile string, keyFile string) (*reloadingKeyPair, error) {
+	keyPair := &reloadingKeyPair{CertFile: certFile, KeyFile: keyFile}
+	_, err := keyPair.get()
+	return keyPair, err
+}
+
+// get returns the current certificate, reloading it when one of the files has a new modification time.
+// When the reload fails the previous certificate is kept, the files may be in the middle of being replaced.
+func (keyPair *reloadingKeyPair) get() (*tls.Certificate, error) {
+	keyPair.lock.Lock()
+	defer keyPair.lock.Unlock()
+	modTime, err := getLatestModTime(keyPair.CertFile, keyPair.KeyFile)
+	if err == nil && modTime.Equal(keyPair.modTime) && keyPair.certificate != nil {
+		return keyPair.certificate, nil
+	}
+	if err == nil {
+		var certificate tls.Certificate
+		certificate, err = tls.LoadX509KeyPair(keyPair.CertFile, keyPair.KeyFile)
+		if err == nil {
+			if keyPair.certificate != nil {
+				log.Printf("@I Reloaded certificate %v\n", keyPair.CertFile)
+			}
+			keyPair.certificate = &certificate
+			keyPair.modTime = modTime
+			return keyPair.certificate, nil
+		}
+	}
+	if keyPair.certificate != nil {
+		log.Printf("@W Unable to reload certificate %v, keeping the loaded one: %v\n", keyPair.CertFile, err)
+		return keyPair.certificate, nil
+	}
+	return nil, fmt.Errorf("loading certificate %v: %w", keyPair.CertFile, err)
+}
+
+func (keyPair *reloadingKeyPair) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return keyPair.get()
+}
+
+func getLatestModTime(files ...string) (time.Time, error) {
+	latest := time.Time{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// readSecretFile reads a token or password from a file, surrounding whitespace like a trailing newline is dropped
+func readSecretFile(file string) (string, error) {
+	value, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(value)), nil
+}
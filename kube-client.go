@@ -2,67 +2,175 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
 	traefiktypes "github.com/traefik/traefik/v3/pkg/types"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 type KubeClient struct {
-	context                        context.Context
-	age                            time.Time
-	lastResult                     *traefikconfig.Configuration
-	client                         *kubernetes.Clientset
-	nextServiceID                  int
-	nextServerTransportID          int
+	context               context.Context
+	cancel                context.CancelFunc
+	startLock             sync.Mutex                     // Serializes creating the client and starting the informers
+	snapshot              atomic.Pointer[configSnapshot] // Latest build, never modified after it is stored
+	client                *kubernetes.Clientset
+	informerFactory       informers.SharedInformerFactory
+	ingressLister         networkinglisters.IngressLister
+	serviceLister         corelisters.ServiceLister
+	dynamicClient         dynamic.Interface
+	gatewayLister         cache.GenericLister
+	httpRouteLister       cache.GenericLister
+	tlsRouteLister        cache.GenericLister
+	tcpRouteLister        cache.GenericLister
+	ingressRouteLister    cache.GenericLister
+	ingressRouteTCPLister cache.GenericLister
+	traefikServiceLister  corelisters.ServiceLister
+	changes               chan struct{}
+	statusPublisher       *statusPublisher           // nil for clients without a cluster, like render
+	reloadedConfig        atomic.Pointer[ConfigType] // Reloaded configuration file, applied before the next build
+	warnLock              sync.Mutex
+	WarnPrintStaggerCount map[string]int
+}
+
+// configBuilder is the state of a single build. Every build gets its own, so the shared
+// KubeClient is never written while building and a stored snapshot is never touched again.
+type configBuilder struct {
+	*traefikconfig.Configuration
 	serviceNamesMap                map[string]*Service
 	hostReWriteServersTransportMap map[string]string
-	False                          bool
-	WarnPrintStaggerCount          map[string]int
+	view                           *ViewConfig               // nil builds the full configuration
+	statuses                       map[string]*ingressStatus // Export status of every ingress, only collected by the full build
+}
+
+// configSnapshot is the full configuration and the configuration of every view from the same build,
+// encoded once so polls between changes only write out the cached bytes
+type configSnapshot struct {
+	Configuration *encodedConfiguration
+	Views         map[string]*encodedConfiguration
+	statuses      map[string]*ingressStatus
 }
 
+const (
+	// Time allowed for the informer caches to do their initial list
+	InformerSyncTimeout = 60 * time.Second
+	// Added to the priority of routers on exact hosts, so they win over wildcard hosts whatever the rule lengths
+	ExactHostPriority = 100000
+)
+
+// GetTraefikConfiguration returns the latest configuration built from the informer caches.
+// The first call creates the client and starts the informers, later calls only load the current snapshot
+// and never reach the API server. The returned configuration is shared and must not be modified.
 func (kube *KubeClient) GetTraefikConfiguration() (*traefikconfig.Configuration, error) {
-	var err error = nil
-	if kube.client == nil {
-		if Config.Debug {
-			log.Println("@D No client defined, creating new client")
-		}
-		err = kube.newConfig()
-		if err != nil {
-			log.Println("@E Errer creating client configuration")
-			kube.client = nil
-			return nil, err
-		}
-		kube.lastResult, err = kube.getTraefikConfiguration()
+	encoded, err := kube.GetEncodedConfiguration("")
+	if err != nil {
+		return nil, err
+	}
+	return encoded.Configuration, nil
+}
+
+// GetViewConfiguration is GetTraefikConfiguration for a named view
+func (kube *KubeClient) GetViewConfiguration(view string) (*traefikconfig.Configuration, error) {
+	encoded, err := kube.GetEncodedConfiguration(view)
+	if err != nil {
+		return nil, err
+	}
+	return encoded.Configuration, nil
+}
+
+// GetEncodedConfiguration returns the encoded configuration of a view, or the full configuration for an empty view
+func (kube *KubeClient) GetEncodedConfiguration(view string) (*encodedConfiguration, error) {
+	snapshot, err := kube.getSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if view == "" {
+		return snapshot.Configuration, nil
+	}
+	encoded, ok := snapshot.Views[view]
+	if !ok {
+		return nil, fmt.Errorf("unknown view %v", view)
+	}
+	return encoded, nil
+}
+
+func (kube *KubeClient) getSnapshot() (*configSnapshot, error) {
+	if snapshot := kube.snapshot.Load(); snapshot != nil {
+		return snapshot, nil
+	}
+	kube.startLock.Lock()
+	defer kube.startLock.Unlock()
+	if snapshot := kube.snapshot.Load(); snapshot != nil {
+		return snapshot, nil
+	}
+	if Config.Debug {
+		log.Println("@D No client defined, creating new client")
+	}
+	err := kube.newConfig()
+	if err != nil {
+		log.Println("@E Errer creating client configuration")
+		kube.client = nil
+		return nil, err
+	}
+	err = kube.startInformers()
+	if err != nil {
+		log.Println("@E Errer Getting ingress data, resetting client")
+		kube.client = nil
+		return nil, err
+	}
+	return kube.snapshot.Load(), nil
+}
+
+// buildSnapshot builds the full configuration and the configuration of every view
+func (kube *KubeClient) buildSnapshot() (*configSnapshot, error) {
+	kube.applyReloadedConfig()
+	builder, err := kube.buildConfiguration(nil)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &configSnapshot{Views: make(map[string]*encodedConfiguration), statuses: builder.statuses}
+	snapshot.Configuration, err = newEncodedConfiguration(builder.Configuration)
+	if err != nil {
+		return nil, err
+	}
+	for i := range Config.Views {
+		view := &Config.Views[i]
+		configuration, err := kube.getTraefikConfiguration(view)
 		if err != nil {
-			log.Println("@E Errer Getting ingress data, resetting client")
-			kube.client = nil
 			return nil, err
 		}
-		kube.age = time.Now()
-	}
-	if time.Now().Sub(kube.age).Seconds() > 5 {
-		kube.lastResult, err = kube.getTraefikConfiguration()
+		snapshot.Views[view.Name], err = newEncodedConfiguration(configuration)
 		if err != nil {
-			log.Println("@E Errer Getting ingress data, resetting client")
-			kube.client = nil
 			return nil, err
 		}
-		kube.age = time.Now()
 	}
-	return kube.lastResult, err
+	return snapshot, nil
 }
 
 func (kube *KubeClient) newConfig() error {
 	var config *rest.Config
 	var err error
-	kube.False = false
 	if Kubeconfig != "" {
 		log.Printf("@I Using kubeconfig in: %v\n", Kubeconfig)
 		config, err = clientcmd.BuildConfigFromFlags("", Kubeconfig)
@@ -80,11 +188,157 @@ func (kube *KubeClient) newConfig() error {
 	if err != nil {
 		return err
 	}
-	kube.context = context.Background()
+	kube.dynamicClient, err = dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	kube.context, kube.cancel = context.WithCancel(context.Background())
 	kube.client = clientset
 	return nil
 }
 
+// startInformers sets up shared informers for the exported objects, waits for the initial sync
+// and builds the first configuration. Must be called with kube.startLock held.
+// After the first build all later builds are done by the single rebuild worker.
+func (kube *KubeClient) startInformers() error {
+	kube.informerFactory = informers.NewSharedInformerFactoryWithOptions(kube.client, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = fmt.Sprintf("%v=%v", LableExported, ExportedTrue)
+		}))
+	ingressInformer := kube.informerFactory.Networking().V1().Ingresses()
+	kube.ingressLister = ingressInformer.Lister()
+	kube.changes = make(chan struct{}, 1)
+	_, err := ingressInformer.Informer().AddEventHandler(kube.rebuildEventHandler())
+	if err != nil {
+		kube.cancel()
+		return err
+	}
+	synced := []cache.InformerSynced{ingressInformer.Informer().HasSynced}
+	if Config.Sources.Service.Enabled {
+		serviceInformer := kube.informerFactory.Core().V1().Services()
+		kube.serviceLister = serviceInformer.Lister()
+		_, err = serviceInformer.Informer().AddEventHandler(kube.rebuildEventHandler())
+		if err != nil {
+			kube.cancel()
+			return err
+		}
+		synced = append(synced, serviceInformer.Informer().HasSynced)
+	}
+	kube.informerFactory.Start(kube.context.Done())
+	// Also without events and the annotation, status annotations left from when it was enabled are removed
+	kube.statusPublisher = newStatusPublisher(kube.context, kube.client)
+	if Config.Sources.GatewayAPI.Enabled {
+		gatewaySynced, err := kube.startGatewayInformers(kube.dynamicClient)
+		if err != nil {
+			kube.cancel()
+			return err
+		}
+		synced = append(synced, gatewaySynced...)
+	}
+	if Config.Sources.TraefikCRD.Enabled {
+		traefikSynced, err := kube.startTraefikInformers(kube.dynamicClient)
+		if err != nil {
+			kube.cancel()
+			return err
+		}
+		synced = append(synced, traefikSynced...)
+	}
+
+	syncContext, cancel := context.WithTimeout(kube.context, InformerSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncContext.Done(), synced...) {
+		kube.cancel()
+		kube.informerFactory.Shutdown()
+		return fmt.Errorf("timed out waiting for informers to sync")
+	}
+	// Drop the events queued by the initial list, the first build below covers them
+	select {
+	case <-kube.changes:
+	default:
+	}
+	result, err := kube.buildSnapshot()
+	if err != nil {
+		kube.cancel()
+		kube.informerFactory.Shutdown()
+		return err
+	}
+	kube.storeSnapshot(result)
+	go kube.rebuildWorker()
+	return nil
+}
+
+// storeSnapshot serves a new build. Without children it is also what is served, so it is kept in the history,
+// with children the aggregation is recorded instead.
+func (kube *KubeClient) storeSnapshot(snapshot *configSnapshot) {
+	kube.snapshot.Store(snapshot)
+	if len(getChildControllers()) == 0 {
+		history.record(snapshot.Configuration)
+	}
+	if kube.statusPublisher != nil {
+		kube.statusPublisher.publish(snapshot.statuses)
+	}
+}
+
+// rebuildEventHandler queues a rebuild for every add, delete and actual update of a watched object
+func (kube *KubeClient) rebuildEventHandler() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { kube.queueRebuild() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if oldObj.(metav1.Object).GetResourceVersion() != newObj.(metav1.Object).GetResourceVersion() {
+				kube.queueRebuild()
+			}
+		},
+		DeleteFunc: func(obj interface{}) { kube.queueRebuild() },
+	}
+}
+
+// reloadConfig queues the reloadable parts of a changed configuration file for the next build
+func (kube *KubeClient) reloadConfig(config *ConfigType) {
+	kube.reloadedConfig.Store(config)
+	kube.queueRebuild()
+}
+
+// applyReloadedConfig copies the ingress ports and entrypoint names of a reloaded configuration file.
+// Only builds read them, and builds run one at a time, so they never change in the middle of a build.
+func (kube *KubeClient) applyReloadedConfig() {
+	config := kube.reloadedConfig.Swap(nil)
+	if config == nil {
+		return
+	}
+	Config.Cluster.Ingress = config.Cluster.Ingress
+	Config.Traefik = config.Traefik
+	if Config.Debug {
+		log.Printf("@D Applied reloaded ingress %+v and entrypoints %+v\n", Config.Cluster.Ingress, Config.Traefik)
+	}
+}
+
+// queueRebuild signals the rebuild worker, multiple events before the next build are collapsed into one
+func (kube *KubeClient) queueRebuild() {
+	select {
+	case kube.changes <- struct{}{}:
+	default:
+	}
+}
+
+func (kube *KubeClient) rebuildWorker() {
+	for {
+		select {
+		case <-kube.context.Done():
+			return
+		case <-kube.changes:
+			if Config.Debug {
+				log.Println("@D Watched object changed, rebuilding configuration")
+			}
+			result, err := kube.buildSnapshot()
+			if err != nil {
+				log.Printf("@E Error rebuilding configuration, keeping last result: %v\n", err)
+				continue
+			}
+			kube.storeSnapshot(result)
+		}
+	}
+}
+
 const (
 	CommonName                = "tooc"
 	HTTPServiceName           = CommonName + "-http"
@@ -98,51 +352,142 @@ const (
 	SSLForwardTypePassthrough = "passthrough" //Default
 	SSLForwardTypeReEncrypt   = "reencrypt"
 	LableRewriteHostname      = LablePrefix + "rewrite-hostname" // Free String
+	LableWeight               = LablePrefix + "weight"           // Weight when an aggregator combines the host with other clusters
+	AddressSeparator          = ","
+	StableIDLength            = 5 // Bytes of the backend hash used in service and transport names
 )
 
+// getStableID derives a short id from the backend a service or transport points to,
+// so the same backend keeps the same name across rebuilds and replicas no matter the order objects are listed in.
+func getStableID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:StableIDLength])
+}
+
+// getLoadBalancerAddresses returns the addresses (IP or hostname) to use as servers for an exported object.
+// TOOC_CLUSTER_INGRESS_ADDRESS (a comma separated list is allowed) takes precedence, otherwise every
+// load balancer address found in the object status is used. The result is sorted and without duplicates
+// so the order in the status does not change the generated service.
+func getLoadBalancerAddresses(statusAddresses []string) []string {
+	if Config.Cluster.Ingress.Address != "" {
+		return uniqueAddresses(splitList(Config.Cluster.Ingress.Address))
+	}
+	return uniqueAddresses(statusAddresses)
+}
+
+func uniqueAddresses(statusAddresses []string) []string {
+	addresses := []string{}
+	for _, address := range statusAddresses {
+		if address != "" && !slices.Contains(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// getTCPServers returns a TCP server for every address on the same port
+func getTCPServers(addresses []string, port interface{}) []traefikconfig.TCPServer {
+	servers := []traefikconfig.TCPServer{}
+	for _, address := range addresses {
+		servers = append(servers, traefikconfig.TCPServer{Address: fmt.Sprintf("%v:%v", address, port)})
+	}
+	return servers
+}
+
 type Service struct {
-	IPAddress        string
+	Addresses        []string
 	HTTPServiceName  string
 	HTTPSServiceName string
 	TCPServiceName   string
 }
 
-func (kube *KubeClient) getAppendServiceNames(config *traefikconfig.Configuration, ip string, remoteHost string) *Service {
+// servicePorts are the ports of backends that do not listen on the configured ingress ports,
+// like the listeners of a Gateway. An empty port keeps the ingress port.
+type servicePorts struct {
+	HTTP  string
+	HTTPS string
+}
+
+func (kube *KubeClient) getAppendServiceNames(config *configBuilder, addresses []string, remoteHost string) *Service {
+	return kube.getAppendServiceNamesOnPorts(config, addresses, remoteHost, servicePorts{})
+}
+
+// getAppendServiceNamesOnPorts is getAppendServiceNames for backends on other ports than the ingress ports
+func (kube *KubeClient) getAppendServiceNamesOnPorts(config *configBuilder, addresses []string, remoteHost string, ports servicePorts) *Service {
 	servertransportName := kube.getAppendRewriteServersTransport(config, remoteHost)
-	remoteHostname := ip
+	remoteHostnames := addresses
 	if servertransportName != "" {
-		remoteHostname = remoteHost
+		remoteHostnames = []string{remoteHost}
 	}
-	ipTransportName := fmt.Sprintf("%v-%v", remoteHostname, servertransportName)
-	_, ok := kube.serviceNamesMap[ipTransportName]
+	ipTransportName := fmt.Sprintf("%v-%v", strings.Join(remoteHostnames, AddressSeparator), servertransportName)
+	if ports != (servicePorts{}) {
+		ipTransportName = fmt.Sprintf("%v-%v-%v", ipTransportName, ports.HTTP, ports.HTTPS)
+	}
+	_, ok := config.serviceNamesMap[ipTransportName]
 	if !ok {
-		CurrentHTTPServiceName := fmt.Sprintf("%v-%v", HTTPServiceName, kube.nextServiceID)
-		CurrentHTTPSServiceName := fmt.Sprintf("%v-%v", HTTPSServiceName, kube.nextServiceID)
-		CurrentTCPServiceName := fmt.Sprintf("%v-%v", TCPServiceName, kube.nextServiceID)
-		kube.serviceNamesMap[ipTransportName] = &Service{
-			IPAddress:        ip,
+		serviceID := getStableID(ipTransportName)
+		CurrentHTTPServiceName := fmt.Sprintf("%v-%v", HTTPServiceName, serviceID)
+		CurrentHTTPSServiceName := fmt.Sprintf("%v-%v", HTTPSServiceName, serviceID)
+		CurrentTCPServiceName := fmt.Sprintf("%v-%v", TCPServiceName, serviceID)
+		config.serviceNamesMap[ipTransportName] = &Service{
+			Addresses:        addresses,
 			HTTPServiceName:  CurrentHTTPServiceName,
 			HTTPSServiceName: CurrentHTTPSServiceName,
 			TCPServiceName:   CurrentTCPServiceName,
 		}
 		config.HTTP.Services[CurrentHTTPServiceName] = &traefikconfig.Service{
-			LoadBalancer: kube.createServersLoadBalancer(remoteHostname, servertransportName, false)}
+			LoadBalancer: kube.createServersLoadBalancer(remoteHostnames, servertransportName, false, ports.HTTP)}
 		config.HTTP.Services[CurrentHTTPSServiceName] = &traefikconfig.Service{
-			LoadBalancer: kube.createServersLoadBalancer(remoteHostname, servertransportName, true)}
-		tcpLoadbalancer := &traefikconfig.TCPServersLoadBalancer{
-			Servers: []traefikconfig.TCPServer{
-				{
-					Address: fmt.Sprintf("%v:%v", remoteHostname,
-						Config.Cluster.Ingress.HTTPS.Port),
-				},
-			}}
+			LoadBalancer: kube.createServersLoadBalancer(remoteHostnames, servertransportName, true, ports.HTTPS)}
+		tcpPort := Config.Cluster.Ingress.HTTPS.Port
+		if ports.HTTPS != "" {
+			tcpPort = ports.HTTPS
+		}
+		tcpLoadbalancer := &traefikconfig.TCPServersLoadBalancer{}
+		for _, remoteHostname := range remoteHostnames {
+			tcpLoadbalancer.Servers = append(tcpLoadbalancer.Servers, traefikconfig.TCPServer{
+				Address: fmt.Sprintf("%v:%v", remoteHostname, tcpPort),
+			})
+		}
 		config.TCP.Services[CurrentTCPServiceName] = &traefikconfig.TCPService{
 			LoadBalancer: tcpLoadbalancer}
-		kube.nextServiceID += 1
 	}
-	return kube.serviceNamesMap[ipTransportName]
+	return config.serviceNamesMap[ipTransportName]
 }
+
+// getWeight reads the weight option of an exported object
+func getWeight(object metav1.Object) (int, bool) {
+	value, ok := getOption(object, LableWeight)
+	if !ok {
+		return 0, false
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < 0 {
+		log.Printf("@W getWeight: invalid %v=%v on %v/%v\n", LableWeight, value, object.GetNamespace(), object.GetName())
+		return 0, false
+	}
+	return weight, true
+}
+
+// getAppendWeightedService wraps a service in a single entry weighted service carrying the weight option of an object.
+// Traefik routes to it like to the wrapped service, an aggregator uses the weight when it combines the router
+// with the routers of other clusters.
+func (config *configBuilder) getAppendWeightedService(name string, serviceName string, weight int, tcp bool) string {
+	weightedName := fmt.Sprintf("%v-%v", name, strings.TrimPrefix(serviceName, CommonName+"-"))
+	if tcp {
+		config.TCP.Services[weightedName] = &traefikconfig.TCPService{Weighted: &traefikconfig.TCPWeightedRoundRobin{
+			Services: []traefikconfig.TCPWRRService{{Name: serviceName, Weight: &weight}}}}
+	} else {
+		config.HTTP.Services[weightedName] = &traefikconfig.Service{Weighted: &traefikconfig.WeightedRoundRobin{
+			Services: []traefikconfig.WRRService{{Name: serviceName, Weight: &weight}}}}
+	}
+	return weightedName
+}
+
 func (kube *KubeClient) staggeredWarnning(name string) {
+	kube.warnLock.Lock()
+	defer kube.warnLock.Unlock()
 	if kube.WarnPrintStaggerCount == nil {
 		kube.WarnPrintStaggerCount = make(map[string]int)
 	}
@@ -199,143 +544,349 @@ func (kube *KubeClient) getLBConfig(servertransportName string, https bool) *Por
 		}
 	}
 }
-func (kube *KubeClient) createServersLoadBalancer(remoteHostname string, servertransportName string, https bool) *traefikconfig.ServersLoadBalancer {
+func (kube *KubeClient) createServersLoadBalancer(remoteHostnames []string, servertransportName string, https bool, port string) *traefikconfig.ServersLoadBalancer {
 	config := kube.getLBConfig(servertransportName, https)
+	if port != "" {
+		config = &PortConfig{Port: port, Protocol: config.Protocol}
+	}
 	if Config.Debug {
-		log.Printf("@D createServersLoadBalancer: %v %v %+v\n", remoteHostname, servertransportName, config)
+		log.Printf("@D createServersLoadBalancer: %v %v %+v\n", remoteHostnames, servertransportName, config)
 	}
-	serverLoadbalander := &traefikconfig.ServersLoadBalancer{
-		Servers: []traefikconfig.Server{
-			{
-				URL: fmt.Sprintf("%v://%v:%v/", config.Protocol, remoteHostname, config.Port),
-			},
-		},
+	serverLoadbalander := &traefikconfig.ServersLoadBalancer{}
+	for _, remoteHostname := range remoteHostnames {
+		serverLoadbalander.Servers = append(serverLoadbalander.Servers, traefikconfig.Server{
+			URL: fmt.Sprintf("%v://%v:%v/", config.Protocol, remoteHostname, config.Port),
+		})
 	}
 	if servertransportName != "" {
 		serverLoadbalander.ServersTransport = servertransportName
-		serverLoadbalander.PassHostHeader = &kube.False
+		passHostHeader := false
+		serverLoadbalander.PassHostHeader = &passHostHeader
 	}
 	return serverLoadbalander
 }
 
-func (kube *KubeClient) getAppendRewriteServersTransport(config *traefikconfig.Configuration, hostname string) string {
+func (kube *KubeClient) getAppendRewriteServersTransport(config *configBuilder, hostname string) string {
 	if hostname == "" {
 		return ""
 	}
-	_, ok := kube.hostReWriteServersTransportMap[hostname]
+	_, ok := config.hostReWriteServersTransportMap[hostname]
 	if !ok {
 		if config.HTTP.ServersTransports == nil {
 			config.HTTP.ServersTransports = make(map[string]*traefikconfig.ServersTransport)
 		}
-		CurrentServerTransportName := fmt.Sprintf("%v-%v", ServerTransportName, kube.nextServerTransportID)
-		kube.hostReWriteServersTransportMap[hostname] = CurrentServerTransportName
-		config.HTTP.ServersTransports[CurrentServerTransportName] = &traefikconfig.ServersTransport{
-			ServerName: hostname,
-			RootCAs:    []traefiktypes.FileOrContent{traefiktypes.FileOrContent(Config.Cluster.RootCAFilename)},
+		CurrentServerTransportName := fmt.Sprintf("%v-%v", ServerTransportName, getStableID(hostname))
+		config.hostReWriteServersTransportMap[hostname] = CurrentServerTransportName
+		serversTransport := &traefikconfig.ServersTransport{ServerName: hostname}
+		// Without it the system roots of the external Traefik are used, reported by the validation
+		if Config.Cluster.RootCAFilename != "" {
+			serversTransport.RootCAs = []traefiktypes.FileOrContent{traefiktypes.FileOrContent(Config.Cluster.RootCAFilename)}
 		}
-		kube.nextServerTransportID += 1
+		config.HTTP.ServersTransports[CurrentServerTransportName] = serversTransport
 	}
-	return kube.hostReWriteServersTransportMap[hostname]
+	return config.hostReWriteServersTransportMap[hostname]
 }
 
 // https://github.com/traefik/traefik/tree/master/pkg/config/dynamic
-func (kube *KubeClient) getTraefikConfiguration() (*traefikconfig.Configuration, error) {
-	if Config.Debug {
-		log.Println("@D getTraefikConfiguration: ")
-	}
-	// Implement discovery for ingress controller here: kube.client.CoreV1().Services("") set ingressIP
-	kube.nextServiceID = 0
-	kube.nextServerTransportID = 0
-	kube.serviceNamesMap = make(map[string]*Service)
-	kube.hostReWriteServersTransportMap = make(map[string]string)
-	ingresses, err := kube.client.NetworkingV1().Ingresses("").List(
-		kube.context,
-		metav1.ListOptions{
-			LabelSelector: fmt.Sprintf(
-				"%v=%v",
-				LableExported,
-				ExportedTrue)})
+func (kube *KubeClient) getTraefikConfiguration(view *ViewConfig) (*traefikconfig.Configuration, error) {
+	builder, err := kube.buildConfiguration(view)
 	if err != nil {
 		return nil, err
 	}
+	return builder.Configuration, nil
+}
+
+// buildConfiguration builds the configuration of a view, or the full configuration with the ingress statuses for a nil view
+func (kube *KubeClient) buildConfiguration(view *ViewConfig) (*configBuilder, error) {
 	if Config.Debug {
-		log.Printf("@D getTraefikConfiguration: found %v exported ingresses", len(ingresses.Items))
+		log.Printf("@D getTraefikConfiguration: %+v\n", view)
 	}
-	traefikConfig := &traefikconfig.Configuration{
+	// Implement discovery for ingress controller here: kube.client.CoreV1().Services("") set ingressIP
+	traefikConfig := &configBuilder{
+		serviceNamesMap:                make(map[string]*Service),
+		hostReWriteServersTransportMap: make(map[string]string),
+		view:                           view,
+	}
+	if view == nil {
+		traefikConfig.statuses = make(map[string]*ingressStatus)
+	}
+	traefikConfig.Configuration = &traefikconfig.Configuration{
 		HTTP: &traefikconfig.HTTPConfiguration{
 			Services: make(map[string]*traefikconfig.Service),
 			Routers:  make(map[string]*traefikconfig.Router)},
 		TCP: &traefikconfig.TCPConfiguration{
 			Services: make(map[string]*traefikconfig.TCPService),
 			Routers:  make(map[string]*traefikconfig.TCPRouter)},
+		UDP: &traefikconfig.UDPConfiguration{
+			Services: make(map[string]*traefikconfig.UDPService),
+			Routers:  make(map[string]*traefikconfig.UDPRouter)},
+	}
+	total_rules, err := kube.appendIngresses(traefikConfig)
+	if err != nil {
+		return nil, err
+	}
+	if Config.Sources.GatewayAPI.Enabled {
+		gateway_rules, err := kube.appendGatewayRoutes(traefikConfig)
+		if err != nil {
+			return nil, err
+		}
+		total_rules += gateway_rules
+	}
+	if Config.Sources.Service.Enabled {
+		service_rules, err := kube.appendServices(traefikConfig)
+		if err != nil {
+			return nil, err
+		}
+		total_rules += service_rules
+	}
+	if Config.Sources.TraefikCRD.Enabled {
+		traefik_rules, err := kube.appendTraefikRoutes(traefikConfig)
+		if err != nil {
+			return nil, err
+		}
+		total_rules += traefik_rules
+	}
+	if traefikConfig.reportMetrics() {
+		routes_created_count.Set(float64(total_rules))
+	}
+	return traefikConfig, nil
+}
+
+func (kube *KubeClient) appendIngresses(traefikConfig *configBuilder) (int, error) {
+	ingresses, err := kube.ingressLister.List(labels.Everything())
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(ingresses, func(i, j int) bool {
+		if ingresses[i].Namespace != ingresses[j].Namespace {
+			return ingresses[i].Namespace < ingresses[j].Namespace
+		}
+		return ingresses[i].Name < ingresses[j].Name
+	})
+	if Config.Debug {
+		log.Printf("@D getTraefikConfiguration: found %v exported ingresses", len(ingresses))
 	}
 	total_rules := 0
 	broken_rules := 0
-	for i, ingress := range ingresses.Items {
-		SSLForwardType, forwardOK := ingress.Labels[LableSSLForwardType]
-		if !forwardOK {
-			SSLForwardType = SSLForwardTypePassthrough
+	for i, ingress := range ingresses {
+		if !traefikConfig.includes(ingress) {
+			continue
 		}
-		NewHostname, _ := ingress.Labels[LableRewriteHostname]
-
-		ip := Config.Cluster.Ingress.Address
 		// https://pkg.go.dev/k8s.io/api/networking/v1#Ingress
-		if len(Config.Cluster.Ingress.Address) == 0 {
-			ip = ingress.Status.LoadBalancer.Ingress[0].IP
-		} else {
-			log.Printf("@I getTraefikConfiguration: ingress %v %v did not contain loadbalancer IP, reverting to default\n", ingress.ObjectMeta.Namespace, ingress.ObjectMeta.Name)
+		statusAddresses := []string{}
+		for _, loadBalancer := range ingress.Status.LoadBalancer.Ingress {
+			if loadBalancer.IP != "" {
+				statusAddresses = append(statusAddresses, loadBalancer.IP)
+			} else {
+				statusAddresses = append(statusAddresses, loadBalancer.Hostname)
+			}
 		}
-		if ip == "" {
-			log.Println("@E getTraefikConfiguration: default ip not set aborting")
+		addresses := getLoadBalancerAddresses(statusAddresses)
+		if len(addresses) == 0 {
+			log.Printf("@E getTraefikConfiguration: ingress %v %v has no loadbalancer address and TOOC_CLUSTER_INGRESS_ADDRESS is not set, skipping\n", ingress.ObjectMeta.Namespace, ingress.ObjectMeta.Name)
+			traefikConfig.ingressStatus(ingress).fail(ReasonNoAddress, "The ingress has no load balancer address and TOOC_CLUSTER_INGRESS_ADDRESS is not set, it is not exported")
 			broken_rules += 1
 			continue
 		}
 		name := CommonName + "-" + ingress.ObjectMeta.Namespace + "-" + ingress.ObjectMeta.Name
 		if Config.Debug {
-			log.Printf("@D %v: %v %v %v \n", i, name, SSLForwardType, NewHostname)
-		}
-		for id, rule := range ingress.Spec.Rules {
-			var currentService *Service
-			var currentHostname string
-			if NewHostname == "" {
-				currentHostname = rule.Host
-				currentService = kube.getAppendServiceNames(traefikConfig, ip, "")
-			} else {
-				currentHostname = NewHostname
-				currentService = kube.getAppendServiceNames(traefikConfig, ip, rule.Host)
+			log.Printf("@D %v: %v\n", i, name)
+		}
+		rules := make([]exportedRule, 0, len(ingress.Spec.Rules))
+		for _, rule := range ingress.Spec.Rules {
+			exported := exportedRule{Host: rule.Host}
+			for _, path := range getRulePaths(rule) {
+				matcher, priority := getPathMatcher(path)
+				exported.Matchers = append(exported.Matchers, routeMatcher{Rule: matcher, Priority: priority})
 			}
-			// Path Rules example - && Path(`/traefik`))
-			traefikConfig.HTTP.Routers[fmt.Sprintf("%v-%v", name, id)] = &traefikconfig.Router{
-				EntryPoints: []string{Config.Traefik.HTTP.Entrypoint.Name},
-				Rule:        fmt.Sprintf("Host(`%v`)", currentHostname),
-				Service:     currentService.HTTPServiceName,
+			rules = append(rules, exported)
+		}
+		created, err := kube.appendHTTPRouters(traefikConfig, name, ingress, addresses, servicePorts{}, rules)
+		if err != nil {
+			log.Printf("@E getTraefikConfiguration: ingress %v %v is not exported: %v\n", ingress.ObjectMeta.Namespace, ingress.ObjectMeta.Name, err)
+			traefikConfig.ingressStatus(ingress).fail(ReasonInvalidMiddleware, fmt.Sprintf("The ingress is not exported: %v", err))
+			broken_rules += 1
+			continue
+		}
+		total_rules += created
+	}
+	if traefikConfig.reportMetrics() {
+		exported_ingress_count.Set(float64(len(ingresses)))
+		broken_ingress_count.Set(float64(broken_rules))
+	}
+	return total_rules, nil
+}
+
+// exportedRule is a hostname and the matchers routed for it, it is the common ground for Ingress rules and HTTPRoute hostnames
+type exportedRule struct {
+	Host     string
+	Matchers []routeMatcher
+}
+
+// routeMatcher is the part of a router rule that comes after the host, an empty Rule matches everything on the host
+type routeMatcher struct {
+	Rule     string
+	Priority int
+}
+
+// appendHTTPRouters creates the HTTP routers (and TLS passthrough routers) for the rules of one exported object.
+// The ssl-type, rewrite-hostname and middleware options are read from the object annotations or labels. Returns the amount of rules created.
+func (kube *KubeClient) appendHTTPRouters(traefikConfig *configBuilder, name string, object metav1.Object, addresses []string, ports servicePorts, rules []exportedRule) (int, error) {
+	SSLForwardType, forwardOK := getOption(object, LableSSLForwardType)
+	if !forwardOK {
+		SSLForwardType = SSLForwardTypePassthrough
+	}
+	NewHostname, _ := getOption(object, LableRewriteHostname)
+	if Config.Debug {
+		log.Printf("@D appendHTTPRouters: %v %v %v \n", name, SSLForwardType, NewHostname)
+	}
+	httpMiddlewares, tcpMiddlewares, err := kube.getAppendMiddlewares(traefikConfig, name, object)
+	if err != nil {
+		return 0, err
+	}
+	weight, weighted := getWeight(object)
+	status := traefikConfig.ingressStatus(object)
+	total_rules := 0
+	for id, rule := range rules {
+		var currentService *Service
+		var currentHostname string
+		if NewHostname == "" {
+			currentHostname = rule.Host
+		} else {
+			currentHostname = NewHostname
+		}
+		if currentHostname == "" {
+			log.Printf("@W appendHTTPRouters: %v rule %v has no host, skipping as it would match every host\n", name, id)
+			status.fail(ReasonNoHost, fmt.Sprintf("Rule %v has no host and is not exported, it would match every host", id))
+			continue
+		}
+		if NewHostname == "" {
+			currentService = kube.getAppendServiceNamesOnPorts(traefikConfig, addresses, "", ports)
+		} else {
+			currentService = kube.getAppendServiceNamesOnPorts(traefikConfig, addresses, rule.Host, ports)
+		}
+		httpService, httpsService, tcpService := currentService.HTTPServiceName, currentService.HTTPSServiceName, currentService.TCPServiceName
+		if weighted {
+			httpService = traefikConfig.getAppendWeightedService(name, httpService, weight, false)
+			httpsService = traefikConfig.getAppendWeightedService(name, httpsService, weight, false)
+			tcpService = traefikConfig.getAppendWeightedService(name, tcpService, weight, true)
+		}
+		hostRule := getHostMatcher(currentHostname)
+		status.addHost(currentHostname)
+		for pathID, matcher := range rule.Matchers {
+			routerName := getRouterName(name, id, pathID)
+			routerRule := hostRule
+			if matcher.Rule != "" {
+				routerRule = fmt.Sprintf("%v && %v", hostRule, matcher.Rule)
 			}
-			if SSLForwardType == SSLForwardTypePassthrough {
-				traefikConfig.TCP.Routers[fmt.Sprintf("%v-%v-tls", name, id)] = &traefikconfig.TCPRouter{
-					EntryPoints: []string{Config.Traefik.HTTPS.Entrypoint.Name},
-					Rule:        fmt.Sprintf("HostSNI(`%v`)", currentHostname),
-					Service:     currentService.TCPServiceName,
-					TLS:         &traefikconfig.RouterTCPTLSConfig{Passthrough: true},
-				}
-			} else {
-				if SSLForwardType == SSLForwardTypeReEncrypt {
-					traefikConfig.HTTP.Routers[fmt.Sprintf("%v-%v-tls", name, id)] = &traefikconfig.Router{
-						EntryPoints: []string{Config.Traefik.HTTPS.Entrypoint.Name},
-						Rule:        fmt.Sprintf("Host(`%v`)", currentHostname),
-						Service:     currentService.HTTPSServiceName,
-						TLS:         &traefikconfig.RouterTLSConfig{},
-					}
-				} else {
-					log.Printf("@W GetIngresses: Unsupported annotation option %v=%v", LableSSLForwardType, SSLForwardType)
+			priority := getHostPriority(isWildcardHost(currentHostname), hostRule) + matcher.Priority
+			traefikConfig.HTTP.Routers[routerName] = &traefikconfig.Router{
+				EntryPoints: []string{traefikConfig.httpEntrypoint()},
+				Rule:        routerRule,
+				Priority:    priority,
+				Middlewares: httpMiddlewares,
+				Service:     httpService,
+			}
+			status.addRouter(routerName)
+			if SSLForwardType == SSLForwardTypeReEncrypt {
+				traefikConfig.HTTP.Routers[routerName+"-tls"] = &traefikconfig.Router{
+					EntryPoints: []string{traefikConfig.httpsEntrypoint()},
+					Rule:        routerRule,
+					Priority:    priority,
+					Middlewares: httpMiddlewares,
+					Service:     httpsService,
+					TLS:         &traefikconfig.RouterTLSConfig{},
 				}
+				status.addRouter(routerName + "-tls")
 			}
-			total_rules += 1
 		}
+		// TLS passthrough only sees the SNI, so paths can not be split and one router covers the host
+		if SSLForwardType == SSLForwardTypePassthrough {
+			sniRule := getHostSNIMatcher(currentHostname)
+			traefikConfig.TCP.Routers[fmt.Sprintf("%v-%v-tls", name, id)] = &traefikconfig.TCPRouter{
+				EntryPoints: []string{traefikConfig.httpsEntrypoint()},
+				Rule:        sniRule,
+				Priority:    getHostPriority(isWildcardHost(currentHostname), sniRule),
+				Middlewares: tcpMiddlewares,
+				Service:     tcpService,
+				TLS:         &traefikconfig.RouterTCPTLSConfig{Passthrough: true},
+			}
+			status.addRouter(fmt.Sprintf("%v-%v-tls", name, id))
+		} else if SSLForwardType != SSLForwardTypeReEncrypt {
+			log.Printf("@W GetIngresses: Unsupported annotation option %v=%v", LableSSLForwardType, SSLForwardType)
+			status.fail(ReasonUnsupportedSSL, fmt.Sprintf("Unsupported %v %q, use %v or %v, HTTPS is not exported", LableSSLForwardType, SSLForwardType, SSLForwardTypePassthrough, SSLForwardTypeReEncrypt))
+		}
+		total_rules += 1
 	}
-	if Config.Prometheus.Enabled {
-		exported_ingress_count.Set(float64(len(ingresses.Items)))
-		routes_created_count.Set(float64(total_rules))
-		broken_ingress_count.Set(float64(broken_rules))
+	return total_rules, nil
+}
+
+// getHostMatcher returns the Host matcher for a hostname, wildcard hostnames (*.example.com) match a single label
+func getHostMatcher(hostname string) string {
+	if isWildcardHost(hostname) {
+		return fmt.Sprintf("HostRegexp(`%v`)", getWildcardRegexp(hostname))
 	}
-	return traefikConfig, nil
+	return fmt.Sprintf("Host(`%v`)", hostname)
+}
+
+// getRouterName names the router of a path. The first path keeps the name of the router for the whole rule,
+// so adding a path never renames it. Further paths end in a dot and the path index instead of a dash, so the
+// router of a path never takes the name of a rule of another object, like foo rule 0 path 1 and foo-0 rule 1.
+func getRouterName(name string, ruleID int, pathID int) string {
+	if pathID == 0 {
+		return fmt.Sprintf("%v-%v", name, ruleID)
+	}
+	return fmt.Sprintf("%v-%v.%v", name, ruleID, pathID)
+}
+
+// getHostSNIMatcher is getHostMatcher for TCP routers
+func getHostSNIMatcher(hostname string) string {
+	if isWildcardHost(hostname) {
+		return fmt.Sprintf("HostSNIRegexp(`%v`)", getWildcardRegexp(hostname))
+	}
+	return fmt.Sprintf("HostSNI(`%v`)", hostname)
+}
+
+func isWildcardHost(hostname string) bool {
+	return strings.HasPrefix(hostname, "*.")
+}
+
+// getHostPriority returns the priority of a router on a host rule. Traefik ranks routers by rule length,
+// which would let a long wildcard rule win over the exact host it should leave alone.
+func getHostPriority(wildcard bool, rule string) int {
+	if wildcard {
+		return len(rule)
+	}
+	return ExactHostPriority + len(rule)
+}
+
+func getWildcardRegexp(hostname string) string {
+	return `^[^.]+` + regexp.QuoteMeta(strings.TrimPrefix(hostname, "*")) + `$`
+}
+
+// getRulePaths returns the paths of an ingress rule, a rule without paths is handled as a single catch all path
+func getRulePaths(rule networkingv1.IngressRule) []networkingv1.HTTPIngressPath {
+	if rule.HTTP == nil || len(rule.HTTP.Paths) == 0 {
+		return []networkingv1.HTTPIngressPath{{Path: "/"}}
+	}
+	return rule.HTTP.Paths
+}
+
+// getPathMatcher translates an ingress path into a Traefik path matcher and the priority it adds to the router.
+// Prefix maps to PathPrefix and Exact to Path. ImplementationSpecific (and a missing pathType) is treated as Prefix,
+// the same choice the Traefik kubernetes ingress provider makes.
+// A catch all prefix ("/") gives no matcher so the router stays a plain Host rule.
+// Priority grows with the path length so longer paths win, and an Exact path wins over a Prefix of the same length.
+func getPathMatcher(path networkingv1.HTTPIngressPath) (string, int) {
+	pathType := networkingv1.PathTypePrefix
+	if path.PathType != nil {
+		pathType = *path.PathType
+	}
+	if pathType == networkingv1.PathTypeExact {
+		return fmt.Sprintf("Path(`%v`)", path.Path), 2*len(path.Path) + 1
+	}
+	if path.Path == "" || path.Path == "/" {
+		return "", 0
+	}
+	return fmt.Sprintf("PathPrefix(`%v`)", path.Path), 2 * len(path.Path)
 }
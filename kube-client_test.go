@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetRouterName(t *testing.T) {
+	if name := getRouterName("tooc-default-foo", 0, 0); name != "tooc-default-foo-0" {
+		t.Errorf("first path router is %v, expected the rule router tooc-default-foo-0", name)
+	}
+	// Ingress foo rule 0 path 1 and ingress foo-0 rule 1 path 0 used to both be tooc-default-foo-0-1
+	if getRouterName("tooc-default-foo", 0, 1) == getRouterName("tooc-default-foo-0", 1, 0) {
+		t.Error("the path router of foo takes the name of the rule router of foo-0")
+	}
+	seen := map[string]string{}
+	for _, object := range []string{"foo", "foo-0", "foo-1", "foo-0-1", "foo.0", "foo-0.1", "foo.0-1"} {
+		for ruleID := range 3 {
+			for pathID := range 3 {
+				name := getRouterName("tooc-default-"+object, ruleID, pathID)
+				current := fmt.Sprintf("%v rule %v path %v", object, ruleID, pathID)
+				if other, found := seen[name]; found {
+					t.Errorf("%v and %v are both named %v", other, current, name)
+				}
+				seen[name] = current
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
+)
+
+// kvStore is the key value store the configuration is pushed to. redisClient is the implementation used,
+// anything keeping keys in memory can stand in for it.
+type kvStore interface {
+	// Scan returns all keys starting with prefix
+	Scan(prefix string) ([]string, error)
+	// Update sets and deletes keys in one transaction
+	Update(set map[string]string, remove []string) error
+}
+
+// kvWriter pushes the configuration to a KV store in the layout of the Traefik KV providers
+// (traefik/http/routers/<name>/rule, traefik/http/routers/<name>/entryPoints/0, ...).
+// Only changed keys are written and keys no longer in the configuration are deleted in the same transaction.
+type kvWriter struct {
+	Store   kvStore
+	RootKey string
+	etag    string            // ETag of the configuration in the store, "" until the first write
+	written map[string]string // Keys and values in the store, nil until the existing keys are read
+}
+
+// write updates the store when the configuration changed since the last write
+func (writer *kvWriter) write(encoded *encodedConfiguration) error {
+	if encoded.ETag == writer.etag {
+		return nil
+	}
+	pairs, err := getKVPairs(encoded.Configuration, writer.RootKey)
+	if err != nil {
+		return err
+	}
+	known := writer.written != nil
+	if !known {
+		// Keys left by an earlier run are unknown, they are all rewritten or deleted
+		keys, err := writer.Store.Scan(writer.RootKey + "/")
+		if err != nil {
+			return err
+		}
+		writer.written = make(map[string]string, len(keys))
+		for _, key := range keys {
+			writer.written[key] = ""
+		}
+	}
+	set := make(map[string]string)
+	for key, value := range pairs {
+		if current, ok := writer.written[key]; !known || !ok || current != value {
+			set[key] = value
+		}
+	}
+	remove := []string{}
+	for _, key := range sortedKeys(writer.written) {
+		if _, ok := pairs[key]; !ok {
+			remove = append(remove, key)
+		}
+	}
+	if len(set) > 0 || len(remove) > 0 {
+		if err := writer.Store.Update(set, remove); err != nil {
+			// The store state is unknown after a failed transaction, read it again on the next write
+			writer.written = nil
+			if Config.Prometheus.Enabled {
+				kv_write_errors.Inc()
+			}
+			return err
+		}
+		log.Printf("@I Wrote configuration to %v/, %d keys set and %d deleted\n", writer.RootKey, len(set), len(remove))
+		if Config.Prometheus.Enabled {
+			kv_writes.Inc()
+		}
+	}
+	writer.written = pairs
+	writer.etag = encoded.ETag
+	return nil
+}
+
+// getKVPairs flattens a configuration to keys under rootKey. The JSON field names of the configuration are
+// the names the Traefik KV providers read, lists get their index as key and empty objects like tls: {} become "true".
+func getKVPairs(configuration *traefikconfig.Configuration, rootKey string) (map[string]string, error) {
+	body, err := json.Marshal(configuration)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // Keep numbers as written instead of float64
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	pairs := make(map[string]string)
+	flattenKV(pairs, rootKey, tree, 0)
+	return pairs, nil
+}
+
+// flattenKV adds the leaves of value below key, depth 1 is the http, tcp, udp and tls sections
+// which are left out when empty
+func flattenKV(pairs map[string]string, key string, value interface{}, depth int) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 && depth > 1 {
+			pairs[key] = "true"
+			return
+		}
+		for name, child := range value {
+			flattenKV(pairs, key+"/"+name, child, depth+1)
+		}
+	case []interface{}:
+		for i, child := range value {
+			flattenKV(pairs, key+"/"+strconv.Itoa(i), child, depth+1)
+		}
+	case nil:
+	case string:
+		pairs[key] = value
+	default:
+		pairs[key] = fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
+)
+
+// fakeRedis is an in-process Redis server with the commands redisClient uses: SCAN, MULTI, SET, DEL and EXEC
+type fakeRedis struct {
+	listener     net.Listener
+	lock         sync.Mutex
+	keys         map[string]string
+	transactions int               // EXEC calls that were executed
+	failKeys     map[string]string // Keys a SET in EXEC fails on, with the error reply
+	rejectQueue  string            // Error reply for SET while queueing, the transaction is aborted
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRedis{listener: listener, keys: map[string]string{}, failKeys: map[string]string{}}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *fakeRedis) client() *redisClient {
+	return &redisClient{Address: server.listener.Addr().String(), Timeout: 5 * time.Second}
+}
+
+func (server *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	var queue [][]string
+	queueing, aborted := false, false
+	for {
+		request, err := readRedisReply(reader)
+		if err != nil {
+			return
+		}
+		values, _ := request.([]interface{})
+		command := make([]string, len(values))
+		for i, value := range values {
+			command[i], _ = value.(string)
+		}
+		var reply string
+		switch {
+		case len(command) == 0:
+			reply = "-ERR empty command\r\n"
+		case command[0] == "MULTI":
+			queueing, aborted, queue = true, false, nil
+			reply = "+OK\r\n"
+		case command[0] == "EXEC":
+			reply = server.exec(queue, aborted)
+			queueing, queue = false, nil
+		case queueing && command[0] == "SET" && server.rejection() != "":
+			aborted = true
+			reply = "-" + server.rejection() + "\r\n"
+		case queueing:
+			queue = append(queue, command)
+			reply = "+QUEUED\r\n"
+		default:
+			reply = server.run(command)
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (server *fakeRedis) exec(queue [][]string, aborted bool) string {
+	if aborted {
+		return "-EXECABORT Transaction discarded because of previous errors.\r\n"
+	}
+	server.lock.Lock()
+	server.transactions++
+	server.lock.Unlock()
+	reply := fmt.Sprintf("*%d\r\n", len(queue))
+	for _, command := range queue {
+		reply += server.run(command)
+	}
+	return reply
+}
+
+func (server *fakeRedis) run(command []string) string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	switch command[0] {
+	case "SET":
+		if failure, found := server.failKeys[command[1]]; found {
+			return "-" + failure + "\r\n"
+		}
+		server.keys[command[1]] = command[2]
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range command[1:] {
+			if _, found := server.keys[key]; found {
+				delete(server.keys, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "SCAN":
+		// Everything in one batch, the pattern is a prefix escaped by escapeRedisPattern
+		prefix := strings.NewReplacer(`\\`, `\`, `\*`, `*`, `\?`, `?`, `\[`, `[`, `\]`, `]`).Replace(strings.TrimSuffix(command[3], "*"))
+		keys := []string{}
+		for key := range server.keys {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		reply := fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n", len(keys))
+		for _, key := range keys {
+			reply += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+		}
+		return reply
+	}
+	return fmt.Sprintf("-ERR unknown command '%v'\r\n", command[0])
+}
+
+// update changes the keys or failures, the connections read them under the lock
+func (server *fakeRedis) update(change func()) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	change()
+}
+
+func (server *fakeRedis) rejection() string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.rejectQueue
+}
+
+func (server *fakeRedis) executed() int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.transactions
+}
+
+func (server *fakeRedis) get(key string) (string, bool) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	value, found := server.keys[key]
+	return value, found
+}
+
+func newRoutersConfiguration(t *testing.T, hosts ...string) *encodedConfiguration {
+	configuration := &traefikconfig.Configuration{HTTP: &traefikconfig.HTTPConfiguration{
+		Routers:  map[string]*traefikconfig.Router{},
+		Services: map[string]*traefikconfig.Service{},
+	}}
+	for _, host := range hosts {
+		configuration.HTTP.Routers[host] = &traefikconfig.Router{
+			EntryPoints: []string{"web"},
+			Rule:        fmt.Sprintf("Host(`%v`)", host),
+			Service:     "backend",
+		}
+	}
+	encoded, err := newEncodedConfiguration(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestKVWriterFirstWrite(t *testing.T) {
+	server := newFakeRedis(t)
+	server.update(func() {
+		server.keys["traefik/http/routers/old/rule"] = "Host(`old`)"
+		server.keys["other/key"] = "kept"
+	})
+	writer := &kvWriter{Store: server.client(), RootKey: "traefik"}
+
+	if err := writer.write(newRoutersConfiguration(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]string{
+		"traefik/http/routers/a/rule":          "Host(`a`)",
+		"traefik/http/routers/a/entryPoints/0": "web",
+		"traefik/http/routers/a/service":       "backend",
+		"other/key":                            "kept",
+	} {
+		if value, _ := server.get(key); value != expected {
+			t.Errorf("%v is %q, expected %q", key, value, expected)
+		}
+	}
+	if _, found := server.get("traefik/http/routers/old/rule"); found {
+		t.Error("key left by an earlier run was not deleted")
+	}
+	if transactions := server.executed(); transactions != 1 {
+		t.Errorf("%d transactions, expected 1", transactions)
+	}
+}
+
+func TestKVWriterUpdateRemovesKeys(t *testing.T) {
+	server := newFakeRedis(t)
+	writer := &kvWriter{Store: server.client(), RootKey: "traefik"}
+
+	if err := writer.write(newRoutersConfiguration(t, "a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.write(newRoutersConfiguration(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := server.get("traefik/http/routers/b/rule"); found {
+		t.Error("key of a removed router was not deleted")
+	}
+	if value, _ := server.get("traefik/http/routers/a/rule"); value != "Host(`a`)" {
+		t.Errorf("router a is %q after the update", value)
+	}
+	// An unchanged configuration is not written again
+	if err := writer.write(newRoutersConfiguration(t, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if transactions := server.executed(); transactions != 2 {
+		t.Errorf("%d transactions, expected 2", transactions)
+	}
+}
+
+func TestKVWriterFailedExec(t *testing.T) {
+	for name, setup := range map[string]func(server *fakeRedis){
+		"command failing in exec": func(server *fakeRedis) {
+			server.failKeys["traefik/http/routers/b/rule"] = "WRONGTYPE Operation against a key holding the wrong kind of value"
+		},
+		"command rejected while queueing": func(server *fakeRedis) {
+			server.rejectQueue = "OOM command not allowed when used memory > 'maxmemory'."
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := newFakeRedis(t)
+			writer := &kvWriter{Store: server.client(), RootKey: "traefik"}
+			if err := writer.write(newRoutersConfiguration(t, "a")); err != nil {
+				t.Fatal(err)
+			}
+
+			server.update(func() { setup(server) })
+			encoded := newRoutersConfiguration(t, "b")
+			if err := writer.write(encoded); err == nil {
+				t.Fatal("failed transaction was not reported")
+			}
+			if writer.written != nil || writer.etag == encoded.ETag {
+				t.Error("writer kept its state after a failed transaction")
+			}
+
+			// The next write reads the keys again and catches up
+			server.update(func() {
+				server.failKeys = map[string]string{}
+				server.rejectQueue = ""
+			})
+			if err := writer.write(encoded); err != nil {
+				t.Fatal(err)
+			}
+			if _, found := server.get("traefik/http/routers/a/rule"); found {
+				t.Error("key of a removed router was not deleted after the failure")
+			}
+			if value, _ := server.get("traefik/http/routers/b/rule"); value != "Host(`b`)" {
+				t.Errorf("router b is %q after the failure", value)
+			}
+		})
+	}
+}
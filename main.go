@@ -3,12 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -22,7 +23,7 @@ import (
 var (
 	Config           ConfigType
 	Kubeconfig       string
-	childControllers []ChildController
+	childControllers atomic.Pointer[[]*ChildController] // Replaced as a whole when the configuration file changes
 	requests         = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "http_endpoint_requests_count",
 		Help: "The amount of requests to an endpoint",
@@ -37,16 +38,48 @@ var (
 	broken_ingress_count = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "broken_ingress_count",
 		Help: "Amount of exported ingresses found in cluster that does not have a loadbalancer ip"})
+	exported_gateway_routes_count = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "exported_gateway_routes_count",
+		Help: "Amount of exported Gateway API routes found in cluster"}, []string{"kind"})
+	broken_gateway_routes_count = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "broken_gateway_routes_count",
+		Help: "Amount of exported Gateway API routes found in cluster that does not have a gateway address"}, []string{"kind"})
+	exported_traefik_routes_count = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "exported_traefik_routes_count",
+		Help: "Amount of exported Traefik IngressRoute objects found in cluster"}, []string{"kind"})
+	broken_traefik_routes_count = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "broken_traefik_routes_count",
+		Help: "Amount of exported Traefik IngressRoute objects or routes that could not be exported"}, []string{"kind"})
+	exported_service_count = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "exported_service_count",
+		Help: "Amount of exported services found in cluster"})
+	broken_service_count = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "broken_service_count",
+		Help: "Amount of exported services found in cluster that are not of type LoadBalancer or does not have a loadbalancer address"})
+	router_conflicts_count = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "router_conflicts_count",
+		Help: "Amount of rules exported by more than one source in the last aggregation"})
 	child_fetch_errors = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "child_controller_fetch_errors_total",
 		Help: "Total number of errors fetching from child controllers",
 	}, []string{"child_name"},
 	)
+	child_config_staleness = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "child_controller_config_staleness_seconds",
+		Help: "Age of the configuration served for a child controller, 0 when the last fetch succeeded",
+	}, []string{"child_name"},
+	)
 	child_fetch_success = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "child_controller_fetch_success_total",
 		Help: "Total number of successful fetches from child controllers",
 	}, []string{"child_name"},
 	)
+	kv_writes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kv_writes_total",
+		Help: "Total number of configuration changes written to the KV store"})
+	kv_write_errors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kv_write_errors_total",
+		Help: "Total number of errors writing the configuration to the KV store"})
 
 	client KubeClient
 )
@@ -79,65 +112,81 @@ func MainHandler(w http.ResponseWriter, r *http.Request) {
 		requests.WithLabelValues(r.URL.EscapedPath(), r.Method).Inc()
 	}
 
-	var finalConfig *traefikconfig.Configuration
-	var err error
+	view, found := getRequestView(r)
+	if !found {
+		log.Printf("@I %v %v %v %v - Main Handler unknown view\n", r.Method, r.URL.Path, r.RemoteAddr, 404)
+		http.NotFoundHandler().ServeHTTP(w, r)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	encoded, err := getEncodedConfiguration(ctx, view)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 Internal Server Error"))
+		log.Printf("@E %v %v %v %v - Main Handler Request Error - %+v\n", r.Method, r.URL.Path, r.RemoteAddr, 500, err.Error())
+		return
+	}
 
-	// Check if we have child controllers configured
-	if len(childControllers) > 0 {
-		// Get local configuration
-		localConfig, err := client.GetTraefikConfiguration()
-		if err != nil {
-			log.Printf("@W Error getting local configuration: %v\n", err)
-			localConfig = nil // Continue without local config
-		}
+	status := encoded.write(w, r)
+	if Config.Debug || Config.Print.Ok {
+		log.Printf("@I %v %v %v %v - Main Handler %v\n", r.Method, r.URL.Path, r.RemoteAddr, status, view)
+	}
+	return
+}
 
-		// Get aggregated configuration from all sources
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-		defer cancel()
+// getEncodedConfiguration returns the configuration to serve for a view, "" is the full configuration.
+// With child controllers it is the aggregation of the local configuration and the children.
+func getEncodedConfiguration(ctx context.Context, view string) (*encodedConfiguration, error) {
+	children := getChildControllers()
+	if len(children) == 0 {
+		// No child controllers, just use the local configuration encoded with the snapshot
+		return client.GetEncodedConfiguration(view)
+	}
 
-		finalConfig, err = GetAggregatedConfiguration(ctx, childControllers, localConfig)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("500 Internal Server Error"))
-			log.Printf("@E %v %v %v %v - Main Handler Aggregation Error - %+v\n", r.Method, r.URL.Path, r.RemoteAddr, 500, err.Error())
-			return
-		}
+	// Get local configuration
+	var localConfig *traefikconfig.Configuration
+	localEncoded, err := client.GetEncodedConfiguration(view)
+	if err != nil {
+		log.Printf("@W Error getting local configuration: %v\n", err)
 	} else {
-		// No child controllers, just use local configuration
-		finalConfig, err = client.GetTraefikConfiguration()
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("500 Internal Server Error"))
-			log.Printf("@E %v %v %v %v - Main Handler Request Error - %+v\n", r.Method, r.URL.Path, r.RemoteAddr, 500, err.Error())
-			return
-		}
+		localConfig = localEncoded.Configuration
 	}
 
-	if Config.Debug || Config.Print.Ok {
-		log.Printf("@I %v %v %v %v - Main Handler\n", r.Method, r.URL.Path, r.RemoteAddr, 200)
+	// Get aggregated configuration from all sources
+	finalConfig, err := GetAggregatedConfiguration(ctx, children, localConfig, view)
+	if err != nil {
+		return nil, fmt.Errorf("aggregation: %w", err)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(finalConfig)
-	return
+	return newEncodedConfiguration(finalConfig)
 }
 
 type ConfigType struct {
-	Debug      bool                    `mapstructure:"Debug"`
-	Print      PrintDebug              `mapstructure:"Print"`
-	Port       string                  `mapstructure:"Port"`
-	Cluster    ClusterConfig           `mapstructure:"Cluster"`
-	Traefik    TraefikConfig           `mapstructure:"Traefik"`
-	Prometheus PrometheusConfig        `mapstructure:"Prometheus"`
-	Health     HealthConfig            `mapstructure:"Health"`
-	Children   []ChildControllerConfig `mapstructure:"Children"`
+	Debug       bool                    `mapstructure:"Debug"`
+	Print       PrintDebug              `mapstructure:"Print"`
+	Port        string                  `mapstructure:"Port"`
+	Cluster     ClusterConfig           `mapstructure:"Cluster"`
+	Traefik     TraefikConfig           `mapstructure:"Traefik"`
+	Prometheus  PrometheusConfig        `mapstructure:"Prometheus"`
+	Health      HealthConfig            `mapstructure:"Health"`
+	Sources     SourcesConfig           `mapstructure:"Sources"`
+	Aggregation AggregationConfig       `mapstructure:"Aggregation"`
+	TLS         TLSConfig               `mapstructure:"TLS"`
+	Views       []ViewConfig            `mapstructure:"Views"`
+	Redis       RedisConfig             `mapstructure:"Redis"`
+	File        FileConfig              `mapstructure:"File"`
+	History     HistoryConfig           `mapstructure:"History"`
+	Status      StatusConfig            `mapstructure:"Status"`
+	Children    []ChildControllerConfig `mapstructure:"Children"`
 }
 type PrintDebug struct {
 	Ok bool `mapstructure:"Ok"`
 }
 type ClusterConfig struct {
-	Ingress        IngressConfig `mapstructure:"Ingress"`
-	Kubeconfig     string        `mapstructure:"Kubeconfig"`
-	RootCAFilename string        `mapstructure:"RootCAFilename"`
+	Ingress        IngressConfig        `mapstructure:"Ingress"`
+	Traefik        ClusterTraefikConfig `mapstructure:"Traefik"`
+	Kubeconfig     string               `mapstructure:"Kubeconfig"`
+	RootCAFilename string               `mapstructure:"RootCAFilename"`
 }
 type IngressConfig struct {
 	Address   string           `mapstructure:"Address"`
@@ -145,6 +194,9 @@ type IngressConfig struct {
 	HTTPS     PortConfig       `mapstructure:"HTTPS"`
 	Alternate IngressConfigAlt `mapstructure:"Alt"`
 }
+type ClusterTraefikConfig struct {
+	Service string `mapstructure:"Service"` // namespace/name of the in cluster Traefik service
+}
 type IngressConfigAlt struct {
 	HTTP  PortConfig `mapstructure:"HTTP"`
 	HTTPS PortConfig `mapstructure:"HTTPS"`
@@ -156,6 +208,8 @@ type PortConfig struct {
 type TraefikConfig struct {
 	HTTP  HTTPConfig `mapstructure:"HTTP"`
 	HTTPS HTTPConfig `mapstructure:"HTTPS"`
+	TCP   HTTPConfig `mapstructure:"TCP"`
+	UDP   HTTPConfig `mapstructure:"UDP"`
 }
 type HTTPConfig struct {
 	Entrypoint EntrypointConfig `mapstructure:"Entrypoint"`
@@ -163,6 +217,64 @@ type HTTPConfig struct {
 type EntrypointConfig struct {
 	Name string `mapstructure:"Name"`
 }
+type SourcesConfig struct {
+	GatewayAPI SourceConfig `mapstructure:"GatewayAPI"`
+	TraefikCRD SourceConfig `mapstructure:"TraefikCRD"`
+	Service    SourceConfig `mapstructure:"Service"`
+}
+type SourceConfig struct {
+	Enabled bool `mapstructure:"Enabled"`
+}
+type AggregationConfig struct {
+	ConflictPolicy    string            `mapstructure:"ConflictPolicy"`
+	ConflictsEndpoint string            `mapstructure:"ConflictsEndpoint"`
+	LocalWeight       int               `mapstructure:"LocalWeight"`
+	HealthCheck       HealthCheckConfig `mapstructure:"HealthCheck"`
+}
+type HealthCheckConfig struct {
+	Path     string `mapstructure:"Path"`
+	Interval int    `mapstructure:"Interval"` // Seconds
+}
+type TLSConfig struct {
+	CertFile       string `mapstructure:"CertFile"`
+	KeyFile        string `mapstructure:"KeyFile"`
+	ClientCAFile   string `mapstructure:"ClientCAFile"`
+	AllowedClients string `mapstructure:"AllowedClients"` // Comma separated subject common names or SANs
+}
+type RedisConfig struct {
+	Address      string `mapstructure:"Address"` // host:port, writing to Redis is enabled when set
+	Username     string `mapstructure:"Username"`
+	Password     string `mapstructure:"Password"`
+	PasswordFile string `mapstructure:"PasswordFile"`
+	DB           int    `mapstructure:"DB"`
+	TLS          bool   `mapstructure:"TLS"`
+	RootKey      string `mapstructure:"RootKey"`  // Root key of the Traefik Redis provider
+	Interval     int    `mapstructure:"Interval"` // Seconds between checks for a changed configuration
+	Timeout      int    `mapstructure:"Timeout"`  // Seconds
+}
+
+// String masks the password, so the configuration can be logged
+func (config RedisConfig) String() string {
+	type plain RedisConfig
+	config.Password = redact(config.Password)
+	return fmt.Sprintf("%+v", plain(config))
+}
+
+type FileConfig struct {
+	Directory string `mapstructure:"Directory"` // Writing the configuration to a file is enabled when set
+	Name      string `mapstructure:"Name"`      // File name without extension
+	Format    string `mapstructure:"Format"`    // yaml or toml
+	Interval  int    `mapstructure:"Interval"`  // Seconds between checks for a changed configuration
+}
+type HistoryConfig struct {
+	Size     int    `mapstructure:"Size"`     // Amount of generated configurations kept, 0 disables the history
+	Endpoint string `mapstructure:"Endpoint"` // Path of the diff between kept configurations
+	Interval int    `mapstructure:"Interval"` // Seconds between checks of the aggregated configuration with child controllers
+}
+type StatusConfig struct {
+	Events     bool `mapstructure:"Events"`     // Kubernetes Events on exported ingresses that fail to export or change
+	Annotation bool `mapstructure:"Annotation"` // Write the routers, hosts and errors of exported ingresses to an annotation
+}
 type PrometheusConfig struct {
 	Enabled  bool   `mapstructure:"Enabled"`
 	Endpoint string `mapstructure:"Endpoint"`
@@ -171,10 +283,36 @@ type HealthConfig struct {
 	Endpoint string `mapstructure:"Endpoint"`
 }
 type ChildControllerConfig struct {
-	Name       string `mapstructure:"Name"`
-	URL        string `mapstructure:"URL"`
-	Timeout    int    `mapstructure:"Timeout"`    // Timeout in seconds
-	RootCAFile string `mapstructure:"RootCAFile"` // Path to CA certificate file
+	Name         string `mapstructure:"Name"`
+	URL          string `mapstructure:"URL"`
+	Timeout      int    `mapstructure:"Timeout"`      // Timeout in seconds
+	RootCAFile   string `mapstructure:"RootCAFile"`   // Path to CA certificate file
+	MaxStaleness int    `mapstructure:"MaxStaleness"` // Seconds the last good configuration is served when fetching fails
+	Weight       *int   `mapstructure:"Weight"`       // Weight of the services of the child when conflicting routers are combined
+	// Authentication, a client certificate for mTLS and either a bearer token or basic auth
+	ClientCertFile  string `mapstructure:"ClientCertFile"`
+	ClientKeyFile   string `mapstructure:"ClientKeyFile"`
+	BearerToken     string `mapstructure:"BearerToken"`
+	BearerTokenFile string `mapstructure:"BearerTokenFile"`
+	Username        string `mapstructure:"Username"`
+	Password        string `mapstructure:"Password"`
+	PasswordFile    string `mapstructure:"PasswordFile"`
+}
+
+// String masks the bearer token and password, so the configuration can be logged
+func (config ChildControllerConfig) String() string {
+	type plain ChildControllerConfig
+	config.BearerToken = redact(config.BearerToken)
+	config.Password = redact(config.Password)
+	return fmt.Sprintf("%+v", plain(config))
+}
+
+// redact replaces a secret in logs, an empty secret stays empty so a missing one can still be seen
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
 }
 
 func main() {
@@ -193,69 +331,60 @@ func main() {
 	DynamicConfig.SetDefault("Cluster.Ingress.Alt.HTTPS.Port", "")
 	DynamicConfig.SetDefault("Traefik.HTTP.Entrypoint.Name", "web")
 	DynamicConfig.SetDefault("Traefik.HTTPS.Entrypoint.Name", "websecure")
+	DynamicConfig.SetDefault("Traefik.TCP.Entrypoint.Name", "tcp-"+EntrypointPortTemplate)
+	DynamicConfig.SetDefault("Traefik.UDP.Entrypoint.Name", "udp-"+EntrypointPortTemplate)
 	DynamicConfig.SetDefault("Prometheus.Enabled", true)
 	DynamicConfig.SetDefault("Prometheus.Endpoint", "/metrics")
 	DynamicConfig.SetDefault("Health.Endpoint", "/health")
+	DynamicConfig.SetDefault("Sources.GatewayAPI.Enabled", false)
+	DynamicConfig.SetDefault("Sources.TraefikCRD.Enabled", false)
+	DynamicConfig.SetDefault("Sources.Service.Enabled", false)
+	DynamicConfig.SetDefault("Cluster.Traefik.Service", "")
+	DynamicConfig.SetDefault("Aggregation.ConflictPolicy", ConflictPolicyPriority)
+	DynamicConfig.SetDefault("Aggregation.ConflictsEndpoint", "/debug/conflicts")
+	DynamicConfig.SetDefault("TLS.CertFile", "")
+	DynamicConfig.SetDefault("TLS.KeyFile", "")
+	DynamicConfig.SetDefault("TLS.ClientCAFile", "")
+	DynamicConfig.SetDefault("TLS.AllowedClients", "")
+	DynamicConfig.SetDefault("Aggregation.LocalWeight", DefaultWeight)
+	DynamicConfig.SetDefault("Aggregation.HealthCheck.Path", "")
+	DynamicConfig.SetDefault("Aggregation.HealthCheck.Interval", 10)
+	DynamicConfig.SetDefault("Redis.Address", "")
+	DynamicConfig.SetDefault("Redis.Username", "")
+	DynamicConfig.SetDefault("Redis.Password", "")
+	DynamicConfig.SetDefault("Redis.PasswordFile", "")
+	DynamicConfig.SetDefault("Redis.DB", 0)
+	DynamicConfig.SetDefault("Redis.TLS", false)
+	DynamicConfig.SetDefault("Redis.RootKey", "traefik")
+	DynamicConfig.SetDefault("Redis.Interval", 2)
+	DynamicConfig.SetDefault("Redis.Timeout", 10)
+	DynamicConfig.SetDefault("File.Directory", "")
+	DynamicConfig.SetDefault("File.Name", CommonName)
+	DynamicConfig.SetDefault("File.Format", FileFormatYAML)
+	DynamicConfig.SetDefault("File.Interval", 2)
+	DynamicConfig.SetDefault("History.Size", 10)
+	DynamicConfig.SetDefault("History.Endpoint", "/debug/diff")
+	DynamicConfig.SetDefault("History.Interval", 10)
+	DynamicConfig.SetDefault("Status.Events", true)
+	DynamicConfig.SetDefault("Status.Annotation", false)
 	DynamicConfig.AutomaticEnv()
 
-	for _, key := range DynamicConfig.AllKeys() {
-		DynamicConfig.BindEnv(key, "TOOC_"+strings.ToUpper(strings.ReplaceAll(key, ".", "_")))
+	configFile, err := readConfigFile(&DynamicConfig)
+	if err != nil {
+		log.Printf("@E Error reading configuration file %v: %v - Exiting\n", configFile, err)
+		os.Exit(1)
 	}
-	DynamicConfig.Unmarshal(&Config)
-
-	// Load child controller configurations from environment variables
-	childConfigs := make(map[int]*ChildControllerConfig)
-	for _, env := range os.Environ() {
-		if strings.HasPrefix(env, "TOOC_CHILDREN_") {
-			parts := strings.SplitN(env, "=", 2)
-			if len(parts) != 2 {
-				continue
-			}
-			key := parts[0]
-			value := parts[1]
-
-			// Extract index and field from TOOC_CHILDREN_0_NAME format
-			after := strings.TrimPrefix(key, "TOOC_CHILDREN_")
-			tokens := strings.SplitN(after, "_", 2)
-			if len(tokens) != 2 {
-				continue
-			}
-
-			index, err := strconv.Atoi(tokens[0])
-			if err != nil {
-				continue
-			}
-
-			field := tokens[1]
-
-			if childConfigs[index] == nil {
-				childConfigs[index] = &ChildControllerConfig{}
-			}
-
-			switch field {
-			case "NAME":
-				childConfigs[index].Name = value
-			case "URL":
-				childConfigs[index].URL = value
-			case "TIMEOUT":
-				if timeout, err := strconv.Atoi(value); err == nil {
-					childConfigs[index].Timeout = timeout
-				}
-			case "ROOTCAFILE":
-				childConfigs[index].RootCAFile = value
-			}
-		}
+	bindEnv(&DynamicConfig)
+	problems := []configProblem{}
+	if err := DynamicConfig.Unmarshal(&Config); err != nil {
+		problems = append(problems, configProblem{Message: err.Error(), Fatal: true})
 	}
 
-	// Add child configs to Config in order
-	for i := 0; i < len(childConfigs); i++ {
-		if childConfig, ok := childConfigs[i]; ok && childConfig.Name != "" && childConfig.URL != "" {
-			Config.Children = append(Config.Children, *childConfig)
-			if Config.Debug {
-				log.Printf("@D Loaded child config %d: %+v\n", i, *childConfig)
-			}
-		}
-	}
+	// Load child controller configurations from environment variables, they override children from the file by index
+	Config.Children = getChildConfigsFromEnv(Config.Children)
+
+	// Load views from environment variables
+	Config.Views = getViewConfigsFromEnv(Config.Views)
 
 	if Config.Debug {
 		log.Println("@D viper keys:")
@@ -269,6 +398,15 @@ func main() {
 		log.Printf("@D Config %+v\n", Config)
 	}
 
+	problems = append(problems, validateConfig(&Config)...)
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validateCommand(problems))
+	}
+	if logConfigProblems(problems) {
+		log.Println("@E Invalid configuration - Exiting")
+		os.Exit(1)
+	}
+
 	Kubeconfig = Config.Cluster.Kubeconfig
 	if Kubeconfig == "" {
 		if home := homedir.HomeDir(); home != "" {
@@ -280,21 +418,17 @@ func main() {
 	}
 
 	// Initialize child controllers
-	for _, childConfig := range Config.Children {
-		timeout := 10 * time.Second
-		if childConfig.Timeout > 0 {
-			timeout = time.Duration(childConfig.Timeout) * time.Second
-		}
-		childControllers = append(childControllers, ChildController{
-			Name:       childConfig.Name,
-			URL:        childConfig.URL,
-			Timeout:    timeout,
-			RootCAFile: childConfig.RootCAFile,
-		})
-		log.Printf("@I Registered child controller: %s (%s)\n", childConfig.Name, childConfig.URL)
-		if childConfig.RootCAFile != "" {
-			log.Printf("@I   Using CA certificate: %s\n", childConfig.RootCAFile)
-		}
+	setChildControllers(updateChildControllers(Config.Children, nil))
+
+	switch Config.Aggregation.ConflictPolicy {
+	case ConflictPolicyFirstWins, ConflictPolicyPriority, ConflictPolicyReject, ConflictPolicyCombine, ConflictPolicyFailover:
+	default:
+		// Reported by the validation
+		Config.Aggregation.ConflictPolicy = ConflictPolicyPriority
+	}
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
 	}
 
 	if Config.Prometheus.Enabled {
@@ -302,20 +436,65 @@ func main() {
 		http.Handle(Config.Prometheus.Endpoint, promhttp.Handler())
 	}
 
-	client = KubeClient{}
-	_, err := client.GetTraefikConfiguration()
+	_, err = client.GetTraefikConfiguration()
 	if err != nil {
 		log.Printf("@W Warning getting first configuration: %v\n", err)
 		// Don't exit if we have child controllers configured
-		if len(childControllers) == 0 {
+		if len(getChildControllers()) == 0 {
 			log.Println("@E Error getting first configuration and no child controllers - Exiting")
 			os.Exit(1)
 		}
 	}
 
+	if configFile != "" {
+		watchConfigFile(&DynamicConfig)
+	}
+
 	http.HandleFunc(Config.Health.Endpoint, HealthActuator)
+	if len(getChildControllers()) > 0 || configFile != "" {
+		http.HandleFunc(Config.Aggregation.ConflictsEndpoint, ConflictsHandler)
+	}
+	if Config.History.Size > 0 {
+		http.HandleFunc(Config.History.Endpoint, DiffHandler)
+	}
 	http.HandleFunc("/", MainHandler)
 
+	if Config.Redis.Address != "" {
+		writer := &kvWriter{
+			RootKey: strings.TrimSuffix(Config.Redis.RootKey, "/"),
+			Store: &redisClient{
+				Address:      Config.Redis.Address,
+				Username:     Config.Redis.Username,
+				Password:     Config.Redis.Password,
+				PasswordFile: Config.Redis.PasswordFile,
+				DB:           Config.Redis.DB,
+				TLS:          Config.Redis.TLS,
+				Timeout:      time.Duration(Config.Redis.Timeout) * time.Second,
+			},
+		}
+		log.Printf("@I Writing configuration to redis %v under %v/\n", Config.Redis.Address, writer.RootKey)
+		go runConfigurationWriter(context.Background(), writer, "redis", time.Duration(max(Config.Redis.Interval, 1))*time.Second)
+	}
+
+	if Config.File.Directory != "" {
+		writer := &fileWriter{Directory: Config.File.Directory, Name: Config.File.Name, Format: Config.File.Format}
+		log.Printf("@I Writing configuration to %v\n", writer.path())
+		go runConfigurationWriter(context.Background(), writer, writer.path(), time.Duration(max(Config.File.Interval, 1))*time.Second)
+	}
+
+	if Config.History.Size > 0 {
+		go runConfigurationWriter(context.Background(), &history, "history", time.Duration(max(Config.History.Interval, 1))*time.Second)
+	}
+
+	if Config.TLS.CertFile != "" {
+		server, err := newTLSServer(":"+Config.Port, restrictViewClients(http.DefaultServeMux))
+		if err != nil {
+			log.Printf("@E Error setting up TLS: %v - Exiting\n", err)
+			os.Exit(1)
+		}
+		log.Printf("@I Serving TLS on port %v\n", Config.Port)
+		log.Fatal(server.ListenAndServeTLS("", ""))
+	}
 	log.Printf("@I Serving on port %v\n", Config.Port)
 	log.Fatal(http.ListenAndServe(":"+Config.Port, nil))
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMainHandlerConcurrentPolls polls while the snapshot changes, run it with -race. Every poll gets either
+// 304 for the ETag it sent, or 200 with a body matching the ETag of the response.
+func TestMainHandlerConcurrentPolls(t *testing.T) {
+	first := newRoutersConfiguration(t, "a")
+	second := newRoutersConfiguration(t, "a", "b")
+	bodies := map[string][]byte{first.ETag: first.Body, second.ETag: second.Body}
+	client.storeSnapshot(&configSnapshot{Configuration: first})
+	t.Cleanup(func() { client.snapshot.Store(nil) })
+	server := httptest.NewServer(http.HandlerFunc(MainHandler))
+	defer server.Close()
+
+	poll := func(etag string) (int, string, []byte, error) {
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+		if err != nil {
+			return 0, "", nil, err
+		}
+		if etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		response, err := server.Client().Do(request)
+		if err != nil {
+			return 0, "", nil, err
+		}
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		return response.StatusCode, response.Header.Get("ETag"), body, err
+	}
+
+	var done atomic.Bool
+	var changes sync.WaitGroup
+	changes.Add(1)
+	go func() {
+		defer changes.Done()
+		for i := 0; !done.Load(); i++ {
+			if i%2 == 0 {
+				client.storeSnapshot(&configSnapshot{Configuration: second})
+			} else {
+				client.storeSnapshot(&configSnapshot{Configuration: first})
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	var pollers sync.WaitGroup
+	for range 8 {
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			etag := ""
+			for range 100 {
+				status, responseETag, body, err := poll(etag)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				switch status {
+				case http.StatusOK:
+					if responseETag == etag {
+						t.Errorf("200 for the ETag %v that was sent", etag)
+					}
+					if expected, found := bodies[responseETag]; !found || !bytes.Equal(body, expected) {
+						t.Errorf("body does not match the ETag %v", responseETag)
+					}
+				case http.StatusNotModified:
+					if responseETag != etag || len(body) > 0 {
+						t.Errorf("304 with ETag %v and %d bytes for the ETag %v that was sent", responseETag, len(body), etag)
+					}
+				default:
+					t.Errorf("unexpected status %d", status)
+				}
+				etag = responseETag
+			}
+		}()
+	}
+	pollers.Wait()
+	done.Store(true)
+	changes.Wait()
+
+	// Once the snapshot is settled, the current ETag gets 304 and the other one the current configuration
+	client.storeSnapshot(&configSnapshot{Configuration: second})
+	if status, _, _, err := poll(second.ETag); err != nil || status != http.StatusNotModified {
+		t.Errorf("current ETag got %d, %v", status, err)
+	}
+	if status, etag, body, err := poll(first.ETag); err != nil || status != http.StatusOK || etag != second.ETag || !bytes.Equal(body, second.Body) {
+		t.Errorf("outdated ETag got %d with ETag %v, %v", status, etag, err)
+	}
+}
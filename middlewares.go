@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Middlewares for the generated routers are declared on the exported object.
+// tooc.k8s.stiil.dk/middlewares references middlewares that exist in the external Traefik (name@file),
+// tooc.k8s.stiil.dk/middleware.<type> defines a middleware that is emitted with the configuration.
+// Inline values are the JSON of the Traefik middleware, or a shorthand documented per type.
+const (
+	LableMiddlewares               = LablePrefix + "middlewares"
+	LableMiddlewarePrefix          = LablePrefix + "middleware."
+	MiddlewareIPAllowList          = "ipallowlist"    // Shorthand: comma separated source ranges
+	MiddlewareRateLimit            = "ratelimit"      // Shorthand: average[,burst]
+	MiddlewareHeaders              = "headers"        // JSON only
+	MiddlewareRedirectScheme       = "redirectscheme" // Shorthand: scheme[:port], always permanent
+	MiddlewareCompress             = "compress"       // Shorthand: true
+	MiddlewareListSeparator        = ","
+	MiddlewareRedirectPortSplitter = ":"
+)
+
+// Order the inline middlewares are applied in, access control first
+var inlineMiddlewareTypes = []string{
+	MiddlewareIPAllowList,
+	MiddlewareRateLimit,
+	MiddlewareRedirectScheme,
+	MiddlewareHeaders,
+	MiddlewareCompress,
+}
+
+// parseInlineMiddleware builds the middleware for one inline type from its option value
+func parseInlineMiddleware(middlewareType string, value string) (*traefikconfig.Middleware, error) {
+	value = strings.TrimSpace(value)
+	isJSON := strings.HasPrefix(value, "{")
+	middleware := &traefikconfig.Middleware{}
+	switch middlewareType {
+	case MiddlewareIPAllowList:
+		middleware.IPAllowList = &traefikconfig.IPAllowList{}
+		if isJSON {
+			if err := decodeMiddlewareJSON(value, middleware.IPAllowList); err != nil {
+				return nil, err
+			}
+		} else {
+			middleware.IPAllowList.SourceRange = splitList(value)
+		}
+		if len(middleware.IPAllowList.SourceRange) == 0 {
+			return nil, fmt.Errorf("no source ranges")
+		}
+	case MiddlewareRateLimit:
+		middleware.RateLimit = &traefikconfig.RateLimit{}
+		if isJSON {
+			return middleware, decodeMiddlewareJSON(value, middleware.RateLimit)
+		}
+		average, burst, hasBurst := strings.Cut(value, MiddlewareListSeparator)
+		parsed, err := strconv.ParseInt(strings.TrimSpace(average), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("average %q is not a number", average)
+		}
+		middleware.RateLimit.Average = parsed
+		if hasBurst {
+			parsed, err = strconv.ParseInt(strings.TrimSpace(burst), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("burst %q is not a number", burst)
+			}
+			middleware.RateLimit.Burst = parsed
+		}
+	case MiddlewareHeaders:
+		middleware.Headers = &traefikconfig.Headers{}
+		return middleware, decodeMiddlewareJSON(value, middleware.Headers)
+	case MiddlewareRedirectScheme:
+		middleware.RedirectScheme = &traefikconfig.RedirectScheme{}
+		if isJSON {
+			return middleware, decodeMiddlewareJSON(value, middleware.RedirectScheme)
+		}
+		scheme, port, _ := strings.Cut(value, MiddlewareRedirectPortSplitter)
+		middleware.RedirectScheme.Scheme = scheme
+		middleware.RedirectScheme.Port = port
+		middleware.RedirectScheme.Permanent = true
+	case MiddlewareCompress:
+		middleware.Compress = &traefikconfig.Compress{}
+		if isJSON {
+			return middleware, decodeMiddlewareJSON(value, middleware.Compress)
+		}
+		if enabled, err := strconv.ParseBool(value); err != nil || !enabled {
+			return nil, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported middleware type %v", middlewareType)
+	}
+	return middleware, nil
+}
+
+// decodeMiddlewareJSON decodes a middleware strictly, a misspelled field is an error instead of a middleware that does nothing
+func decodeMiddlewareJSON(value string, middleware interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(middleware)
+}
+
+func splitList(value string) []string {
+	result := []string{}
+	for _, item := range strings.Split(value, MiddlewareListSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getAppendMiddlewares emits the inline middlewares of an exported object and returns the middleware names
+// to attach to its HTTP routers and its TLS passthrough routers.
+// Only the IP allowlist can be applied to passthrough routers, it is emitted as a TCP middleware as well.
+// An invalid middleware is an error and nothing is emitted, the object must not be exported without
+// an ipallowlist it asked for.
+func (kube *KubeClient) getAppendMiddlewares(traefikConfig *configBuilder, name string, object metav1.Object) ([]string, []string, error) {
+	middlewares := make(map[string]*traefikconfig.Middleware)
+	for _, middlewareType := range inlineMiddlewareTypes {
+		value, ok := getOption(object, LableMiddlewarePrefix+middlewareType)
+		if !ok {
+			continue
+		}
+		middleware, err := parseInlineMiddleware(middlewareType, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %v%v: %w", LableMiddlewarePrefix, middlewareType, err)
+		}
+		if middleware != nil {
+			middlewares[middlewareType] = middleware
+		}
+	}
+	httpMiddlewares := []string{}
+	tcpMiddlewares := []string{}
+	for _, middlewareType := range inlineMiddlewareTypes {
+		middleware, ok := middlewares[middlewareType]
+		if !ok {
+			continue
+		}
+		middlewareName := fmt.Sprintf("%v-%v", name, middlewareType)
+		if traefikConfig.HTTP.Middlewares == nil {
+			traefikConfig.HTTP.Middlewares = make(map[string]*traefikconfig.Middleware)
+		}
+		traefikConfig.HTTP.Middlewares[middlewareName] = middleware
+		httpMiddlewares = append(httpMiddlewares, middlewareName)
+		if middleware.IPAllowList != nil {
+			traefikConfig.appendTCPIPAllowList(middlewareName, middleware.IPAllowList)
+			tcpMiddlewares = append(tcpMiddlewares, middlewareName)
+		}
+	}
+	if references, ok := getOption(object, LableMiddlewares); ok {
+		httpMiddlewares = append(httpMiddlewares, splitList(references)...)
+	}
+	if len(httpMiddlewares) == 0 {
+		httpMiddlewares = nil
+	}
+	if len(tcpMiddlewares) == 0 {
+		tcpMiddlewares = nil
+	}
+	return httpMiddlewares, tcpMiddlewares, nil
+}
+
+// getAppendTCPMiddlewares is getAppendMiddlewares for objects that are only exported as TCP routers.
+// The ipallowlist is the only middleware with a TCP version, any other middleware option is an error
+// so the object is not exported without a restriction it asks for.
+func (kube *KubeClient) getAppendTCPMiddlewares(traefikConfig *configBuilder, name string, object metav1.Object) ([]string, error) {
+	for _, option := range getMiddlewareOptions(object) {
+		if option != LableMiddlewarePrefix+MiddlewareIPAllowList {
+			return nil, fmt.Errorf("%v can not be applied to TCP routers", option)
+		}
+	}
+	value, ok := getOption(object, LableMiddlewarePrefix+MiddlewareIPAllowList)
+	if !ok {
+		return nil, nil
+	}
+	middleware, err := parseInlineMiddleware(MiddlewareIPAllowList, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v%v: %w", LableMiddlewarePrefix, MiddlewareIPAllowList, err)
+	}
+	middlewareName := fmt.Sprintf("%v-%v", name, MiddlewareIPAllowList)
+	traefikConfig.appendTCPIPAllowList(middlewareName, middleware.IPAllowList)
+	return []string{middlewareName}, nil
+}
+
+// getMiddlewareOptions returns the middleware options set on an object
+func getMiddlewareOptions(object metav1.Object) []string {
+	options := []string{}
+	if _, ok := getOption(object, LableMiddlewares); ok {
+		options = append(options, LableMiddlewares)
+	}
+	for _, middlewareType := range inlineMiddlewareTypes {
+		if _, ok := getOption(object, LableMiddlewarePrefix+middlewareType); ok {
+			options = append(options, LableMiddlewarePrefix+middlewareType)
+		}
+	}
+	return options
+}
+
+// appendTCPIPAllowList adds the TCP version of an ipallowlist middleware
+func (config *configBuilder) appendTCPIPAllowList(name string, ipAllowList *traefikconfig.IPAllowList) {
+	if config.TCP.Middlewares == nil {
+		config.TCP.Middlewares = make(map[string]*traefikconfig.TCPMiddleware)
+	}
+	config.TCP.Middlewares[name] = &traefikconfig.TCPMiddleware{
+		IPAllowList: &traefikconfig.TCPIPAllowList{SourceRange: ipAllowList.SourceRange},
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RedisScanCount = 1000 // Keys asked for per SCAN call
+)
+
+// redisClient is a minimal Redis client speaking RESP over a single connection, enough to write the
+// Traefik KV layout. The connection is opened on first use and dropped on any error, the next call reconnects.
+type redisClient struct {
+	Address      string
+	Username     string
+	Password     string
+	PasswordFile string
+	DB           int
+	TLS          bool
+	Timeout      time.Duration
+	lock         sync.Mutex
+	conn         net.Conn
+	reader       *bufio.Reader
+}
+
+// redisError is an error reply from the server
+type redisError string
+
+func (err redisError) Error() string {
+	return "redis: " + string(err)
+}
+
+// Scan returns all keys starting with prefix
+func (redis *redisClient) Scan(prefix string) ([]string, error) {
+	redis.lock.Lock()
+	defer redis.lock.Unlock()
+	keys := []string{}
+	cursor := "0"
+	for {
+		replies, err := redis.do([]string{"SCAN", cursor, "MATCH", escapeRedisPattern(prefix) + "*", "COUNT", strconv.Itoa(RedisScanCount)})
+		if err != nil {
+			return nil, err
+		}
+		reply, ok := replies[0].([]interface{})
+		if !ok || len(reply) != 2 {
+			return nil, fmt.Errorf("redis: unexpected SCAN reply %v", replies[0])
+		}
+		cursor, _ = reply[0].(string)
+		batch, _ := reply[1].([]interface{})
+		for _, key := range batch {
+			if key, ok := key.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// Update sets and deletes keys in a single MULTI/EXEC transaction, readers never see a half written configuration
+func (redis *redisClient) Update(set map[string]string, remove []string) error {
+	redis.lock.Lock()
+	defer redis.lock.Unlock()
+	commands := [][]string{{"MULTI"}}
+	if len(remove) > 0 {
+		commands = append(commands, append([]string{"DEL"}, remove...))
+	}
+	for _, key := range sortedKeys(set) {
+		commands = append(commands, []string{"SET", key, set[key]})
+	}
+	commands = append(commands, []string{"EXEC"})
+	replies, err := redis.do(commands...)
+	if err != nil {
+		return err
+	}
+	// Commands rejected while queueing abort the transaction, report the first reason
+	for _, reply := range replies {
+		if err, ok := reply.(redisError); ok {
+			return err
+		}
+	}
+	results, ok := replies[len(replies)-1].([]interface{})
+	if !ok {
+		return fmt.Errorf("redis: transaction aborted")
+	}
+	// Commands failing in EXEC do not roll back the others, the caller reads the keys again
+	for _, result := range results {
+		if err, ok := result.(redisError); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends the commands in one pipeline and reads a reply for each, the caller holds the lock.
+// Error replies are returned as redisError values in the replies, only connection and protocol errors fail the call.
+func (redis *redisClient) do(commands ...[]string) ([]interface{}, error) {
+	if err := redis.connect(); err != nil {
+		return nil, err
+	}
+	replies, err := redis.roundTrip(commands)
+	if err != nil {
+		redis.close()
+		return nil, err
+	}
+	return replies, nil
+}
+
+func (redis *redisClient) roundTrip(commands [][]string) ([]interface{}, error) {
+	if redis.Timeout > 0 {
+		redis.conn.SetDeadline(time.Now().Add(redis.Timeout))
+	}
+	var request strings.Builder
+	for _, command := range commands {
+		fmt.Fprintf(&request, "*%d\r\n", len(command))
+		for _, arg := range command {
+			fmt.Fprintf(&request, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := io.WriteString(redis.conn, request.String()); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, 0, len(commands))
+	for range commands {
+		reply, err := readRedisReply(redis.reader)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// connect opens the connection, authenticates and selects the database
+func (redis *redisClient) connect() error {
+	if redis.conn != nil {
+		return nil
+	}
+	dialer := &net.Dialer{Timeout: redis.Timeout}
+	var conn net.Conn
+	var err error
+	if redis.TLS {
+		host, _, _ := net.SplitHostPort(redis.Address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", redis.Address, &tls.Config{MinVersion: tls.VersionTLS12, ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", redis.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to redis %v: %w", redis.Address, err)
+	}
+	redis.conn = conn
+	redis.reader = bufio.NewReader(conn)
+
+	setup := [][]string{}
+	password := redis.Password
+	if redis.PasswordFile != "" {
+		password, err = readSecretFile(redis.PasswordFile)
+		if err != nil {
+			redis.close()
+			return fmt.Errorf("reading redis password file: %w", err)
+		}
+	}
+	if password != "" {
+		if redis.Username != "" {
+			setup = append(setup, []string{"AUTH", redis.Username, password})
+		} else {
+			setup = append(setup, []string{"AUTH", password})
+		}
+	}
+	if redis.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(redis.DB)})
+	}
+	if len(setup) == 0 {
+		return nil
+	}
+	replies, err := redis.roundTrip(setup)
+	if err == nil {
+		for _, reply := range replies {
+			if replyErr, ok := reply.(redisError); ok {
+				err = replyErr
+				break
+			}
+		}
+	}
+	if err != nil {
+		redis.close()
+		return fmt.Errorf("setting up redis connection: %w", err)
+	}
+	return nil
+}
+
+func (redis *redisClient) close() {
+	if redis.conn != nil {
+		redis.conn.Close()
+	}
+	redis.conn = nil
+	redis.reader = nil
+}
+
+// readRedisReply reads one RESP2 reply: simple strings and bulk strings as string, integers as int64,
+// arrays as []interface{}, nil bulk strings and arrays as nil and errors as redisError
+func readRedisReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		value := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, err
+		}
+		return string(value[:length]), nil
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, 0, length)
+		for i := 0; i < length; i++ {
+			value, err := readRedisReply(reader)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+}
+
+// escapeRedisPattern escapes the glob characters of a SCAN MATCH pattern
+func escapeRedisPattern(pattern string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return replacer.Replace(pattern)
+}
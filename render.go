@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// renderCommand generates the configuration from manifest files without a cluster, to preview a change before it is applied.
+// Objects are filtered like the informers do: only objects with the export label, except gateways and the Traefik service.
+func renderCommand(args []string) int {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	format := flags.String("format", "json", "json, yaml or toml")
+	view := flags.String("view", "", "Render a view instead of the full configuration")
+	namespace := flags.String("namespace", "default", "Namespace of objects without one")
+	address := flags.String("address", Config.Cluster.Ingress.Address, "Load balancer addresses, manifests have no status (TOOC_CLUSTER_INGRESS_ADDRESS)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: traefik-out-of-cluster render [flags] [file or directory ...]\n\nManifests are read from stdin without files or with -.\n\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	var viewConfig *ViewConfig
+	if *view != "" {
+		viewConfig = getViewConfig(*view)
+		if viewConfig == nil {
+			fmt.Fprintf(os.Stderr, "Unknown view %v\n", *view)
+			return 2
+		}
+	}
+	Config.Cluster.Ingress.Address = *address
+
+	objects, err := readManifests(flags.Args(), *namespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading manifests: %v\n", err)
+		return 1
+	}
+	kube, err := newManifestClient(objects)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading manifests: %v\n", err)
+		return 1
+	}
+	configuration, err := kube.getTraefikConfiguration(viewConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating configuration: %v\n", err)
+		return 1
+	}
+	encoded, err := newEncodedConfiguration(configuration)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding configuration: %v\n", err)
+		return 1
+	}
+	var output []byte
+	if *format == "json" {
+		var indented bytes.Buffer
+		err = json.Indent(&indented, encoded.Body, "", "  ")
+		output = indented.Bytes()
+	} else {
+		output, err = encodeConfigurationFile(encoded, *format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding configuration: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(output)
+	return 0
+}
+
+// readManifests reads the objects of YAML or JSON manifests, multiple documents and List kinds included.
+// Directories are read for .yaml, .yml and .json files, - or no paths reads stdin.
+func readManifests(paths []string, namespace string) ([]*unstructured.Unstructured, error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	objects := []*unstructured.Unstructured{}
+	for _, path := range paths {
+		files := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			files = []string{}
+			err := filepath.WalkDir(path, func(file string, entry os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				switch filepath.Ext(file) {
+				case ".yaml", ".yml", ".json":
+					files = append(files, file)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, file := range files {
+			var reader io.Reader = os.Stdin
+			if file != "-" {
+				handle, err := os.Open(file)
+				if err != nil {
+					return nil, err
+				}
+				defer handle.Close()
+				reader = handle
+			}
+			fileObjects, err := decodeManifests(reader, namespace)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %w", file, err)
+			}
+			objects = append(objects, fileObjects...)
+		}
+	}
+	return objects, nil
+}
+
+func decodeManifests(reader io.Reader, namespace string) ([]*unstructured.Unstructured, error) {
+	decoder := yamlutil.NewYAMLOrJSONDecoder(reader, 4096)
+	objects := []*unstructured.Unstructured{}
+	for {
+		object := &unstructured.Unstructured{}
+		err := decoder.Decode(&object.Object)
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(object.Object) == 0 {
+			continue // Empty document
+		}
+		items := []*unstructured.Unstructured{object}
+		if object.IsList() {
+			list, err := object.ToList()
+			if err != nil {
+				return nil, err
+			}
+			items = items[:0]
+			for i := range list.Items {
+				items = append(items, &list.Items[i])
+			}
+		}
+		for _, item := range items {
+			if item.GetNamespace() == "" {
+				item.SetNamespace(namespace)
+			}
+			objects = append(objects, item)
+		}
+	}
+}
+
+// newManifestClient returns a client with listers serving the given objects instead of informers,
+// the generation reads listers only and does not see the difference
+func newManifestClient(objects []*unstructured.Unstructured) (*KubeClient, error) {
+	kube := &KubeClient{}
+	ingresses := newManifestIndexer()
+	services := newManifestIndexer()
+	traefikServices := newManifestIndexer()
+	dynamicIndexers := map[schema.GroupKind]cache.Indexer{}
+	addDynamic := func(resource schema.GroupVersionResource, kind string, lister *cache.GenericLister) {
+		groupKind := schema.GroupKind{Group: resource.Group, Kind: kind}
+		dynamicIndexers[groupKind] = newManifestIndexer()
+		*lister = cache.NewGenericLister(dynamicIndexers[groupKind], resource.GroupResource())
+	}
+	if Config.Sources.GatewayAPI.Enabled {
+		addDynamic(GatewayResource, "Gateway", &kube.gatewayLister)
+		addDynamic(HTTPRouteResource, "HTTPRoute", &kube.httpRouteLister)
+		addDynamic(TLSRouteResource, "TLSRoute", &kube.tlsRouteLister)
+		addDynamic(TCPRouteResource, "TCPRoute", &kube.tcpRouteLister)
+	}
+	if Config.Sources.TraefikCRD.Enabled {
+		addDynamic(IngressRouteResource, "IngressRoute", &kube.ingressRouteLister)
+		addDynamic(IngressRouteTCPResource, "IngressRouteTCP", &kube.ingressRouteTCPLister)
+	}
+	traefikNamespace, traefikName, _ := strings.Cut(Config.Cluster.Traefik.Service, TraefikServiceSeparator)
+
+	for _, object := range objects {
+		groupKind := object.GroupVersionKind().GroupKind()
+		exported := object.GetLabels()[LableExported] == ExportedTrue
+		var err error
+		switch {
+		case groupKind == schema.GroupKind{Group: networkingv1.GroupName, Kind: "Ingress"}:
+			if exported {
+				err = addManifestObject(ingresses, object, &networkingv1.Ingress{})
+			}
+		case groupKind == schema.GroupKind{Kind: "Service"}:
+			if exported && Config.Sources.Service.Enabled {
+				err = addManifestObject(services, object, &corev1.Service{})
+			}
+			if err == nil && Config.Sources.TraefikCRD.Enabled && object.GetNamespace() == traefikNamespace && object.GetName() == traefikName {
+				err = addManifestObject(traefikServices, object, &corev1.Service{})
+			}
+		case dynamicIndexers[groupKind] != nil:
+			if exported || groupKind.Kind == "Gateway" {
+				err = dynamicIndexers[groupKind].Add(object)
+			}
+		default:
+			if exported {
+				log.Printf("@W render: skipping exported %v %v/%v, the kind is not supported or its source is not enabled\n", object.GetKind(), object.GetNamespace(), object.GetName())
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v %v/%v: %w", object.GetKind(), object.GetNamespace(), object.GetName(), err)
+		}
+	}
+	kube.ingressLister = networkinglisters.NewIngressLister(ingresses)
+	kube.serviceLister = corelisters.NewServiceLister(services)
+	if traefikName != "" && Config.Sources.TraefikCRD.Enabled {
+		kube.traefikServiceLister = corelisters.NewServiceLister(traefikServices)
+	}
+	return kube, nil
+}
+
+func newManifestIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// addManifestObject converts an object to its typed form, the typed listers expect it
+func addManifestObject(indexer cache.Indexer, object *unstructured.Unstructured, typed runtime.Object) error {
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, typed); err != nil {
+		return err
+	}
+	return indexer.Add(typed)
+}
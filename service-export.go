@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	ServiceKind             = "service"
+	EntrypointPortTemplate  = "{port}" // Replaced with the service port in entrypoint names
+	EntrypointListSeparator = ","
+	EntrypointPortSeparator = "="
+)
+
+// getOption reads an option from the annotations of an object and falls back to the labels.
+// Annotations allow values that are not valid label values like lists.
+func getOption(object metav1.Object, key string) (string, bool) {
+	if value, ok := object.GetAnnotations()[key]; ok {
+		return value, true
+	}
+	value, ok := object.GetLabels()[key]
+	return value, ok
+}
+
+// getServiceEntrypoint finds the Traefik entrypoint for a service port.
+// The entrypoint option is either a single name used for all ports, or a list like "5432=postgres,mqtt=mqtt"
+// keyed by port number or port name. Without the option the configured default for the protocol is used.
+// {port} in a name is replaced by the port number.
+func getServiceEntrypoint(service *corev1.Service, port corev1.ServicePort) string {
+	entrypoint := Config.Traefik.TCP.Entrypoint.Name
+	if port.Protocol == corev1.ProtocolUDP {
+		entrypoint = Config.Traefik.UDP.Entrypoint.Name
+	}
+	if option, ok := getOption(service, LableEntrypoint); ok {
+		if !strings.Contains(option, EntrypointPortSeparator) {
+			entrypoint = option
+		} else {
+			entrypoint = ""
+			for _, mapping := range strings.Split(option, EntrypointListSeparator) {
+				key, value, _ := strings.Cut(strings.TrimSpace(mapping), EntrypointPortSeparator)
+				if key == port.Name || key == strconv.Itoa(int(port.Port)) {
+					entrypoint = value
+					break
+				}
+			}
+		}
+	}
+	return strings.ReplaceAll(entrypoint, EntrypointPortTemplate, strconv.Itoa(int(port.Port)))
+}
+
+// getServiceStatusAddresses returns the load balancer addresses (IP or hostname) of a service
+func getServiceStatusAddresses(service *corev1.Service) []string {
+	addresses := []string{}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			addresses = append(addresses, ingress.IP)
+		} else {
+			addresses = append(addresses, ingress.Hostname)
+		}
+	}
+	return addresses
+}
+
+func hasUDPPort(service *corev1.Service) bool {
+	for _, port := range service.Spec.Ports {
+		if port.Protocol == corev1.ProtocolUDP {
+			return true
+		}
+	}
+	return false
+}
+
+// appendServices adds raw TCP and UDP routers for exported services of type LoadBalancer.
+// TCP ports are routed with HostSNI(`*`) so every port needs its own entrypoint on the external Traefik.
+func (kube *KubeClient) appendServices(traefikConfig *configBuilder) (int, error) {
+	services, err := kube.serviceLister.List(labels.Everything())
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Namespace != services[j].Namespace {
+			return services[i].Namespace < services[j].Namespace
+		}
+		return services[i].Name < services[j].Name
+	})
+	if Config.Debug {
+		log.Printf("@D appendServices: found %v exported services", len(services))
+	}
+	total_rules := 0
+	broken_services := 0
+	for _, service := range services {
+		if !traefikConfig.includes(service) {
+			continue
+		}
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			log.Printf("@W appendServices: service %v/%v is of type %v, only %v can be exported\n", service.Namespace, service.Name, service.Spec.Type, corev1.ServiceTypeLoadBalancer)
+			broken_services += 1
+			continue
+		}
+		addresses := uniqueAddresses(getServiceStatusAddresses(service))
+		if len(addresses) == 0 {
+			log.Printf("@W appendServices: service %v/%v has no loadbalancer address, skipping\n", service.Namespace, service.Name)
+			broken_services += 1
+			continue
+		}
+		objectName := fmt.Sprintf("%v-%v-%v-%v", CommonName, service.Namespace, ServiceKind, service.Name)
+		if options := getMiddlewareOptions(service); len(options) > 0 && hasUDPPort(service) {
+			log.Printf("@W appendServices: service %v/%v is not exported: %v can not be applied to UDP routers\n", service.Namespace, service.Name, strings.Join(options, ", "))
+			broken_services += 1
+			continue
+		}
+		middlewares, err := kube.getAppendTCPMiddlewares(traefikConfig, objectName, service)
+		if err != nil {
+			log.Printf("@W appendServices: service %v/%v is not exported: %v\n", service.Namespace, service.Name, err)
+			broken_services += 1
+			continue
+		}
+		for _, port := range service.Spec.Ports {
+			portName := port.Name
+			if portName == "" {
+				portName = strconv.Itoa(int(port.Port))
+			}
+			name := fmt.Sprintf("%v-%v", objectName, portName)
+			entrypoint := getServiceEntrypoint(service, port)
+			if entrypoint == "" {
+				log.Printf("@W appendServices: no entrypoint for service %v/%v port %v, set %v or the default entrypoint\n", service.Namespace, service.Name, portName, LableEntrypoint)
+				continue
+			}
+			switch port.Protocol {
+			case corev1.ProtocolUDP:
+				traefikConfig.UDP.Services[name] = &traefikconfig.UDPService{
+					LoadBalancer: &traefikconfig.UDPServersLoadBalancer{}}
+				for _, address := range addresses {
+					traefikConfig.UDP.Services[name].LoadBalancer.Servers = append(traefikConfig.UDP.Services[name].LoadBalancer.Servers,
+						traefikconfig.UDPServer{Address: fmt.Sprintf("%v:%v", address, port.Port)})
+				}
+				traefikConfig.UDP.Routers[name] = &traefikconfig.UDPRouter{
+					EntryPoints: []string{entrypoint},
+					Service:     name,
+				}
+			case corev1.ProtocolTCP, "":
+				traefikConfig.TCP.Services[name] = &traefikconfig.TCPService{
+					LoadBalancer: &traefikconfig.TCPServersLoadBalancer{
+						Servers: getTCPServers(addresses, port.Port),
+					}}
+				traefikConfig.TCP.Routers[name] = &traefikconfig.TCPRouter{
+					EntryPoints: []string{entrypoint},
+					Rule:        TraefikCatchAllHostSNI,
+					Middlewares: middlewares,
+					Service:     name,
+				}
+			default:
+				log.Printf("@W appendServices: service %v/%v port %v uses unsupported protocol %v\n", service.Namespace, service.Name, portName, port.Protocol)
+				continue
+			}
+			total_rules += 1
+		}
+	}
+	if traefikConfig.reportMetrics() {
+		exported_service_count.Set(float64(len(services)))
+		broken_service_count.Set(float64(broken_services))
+	}
+	return total_rules, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// reloadingCertPool is a CA bundle loaded from a file that is reloaded when the file changes
+type reloadingCertPool struct {
+	File    string
+	lock    sync.Mutex
+	modTime time.Time
+	pool    *x509.CertPool
+}
+
+func (certPool *reloadingCertPool) get() (*x509.CertPool, error) {
+	certPool.lock.Lock()
+	defer certPool.lock.Unlock()
+	modTime, err := getLatestModTime(certPool.File)
+	if err == nil && modTime.Equal(certPool.modTime) && certPool.pool != nil {
+		return certPool.pool, nil
+	}
+	if err == nil {
+		var caCert []byte
+		caCert, err = os.ReadFile(certPool.File)
+		if err == nil {
+			pool := x509.NewCertPool()
+			if pool.AppendCertsFromPEM(caCert) {
+				if certPool.pool != nil {
+					log.Printf("@I Reloaded client CA %v\n", certPool.File)
+				}
+				certPool.pool = pool
+				certPool.modTime = modTime
+				return certPool.pool, nil
+			}
+			err = fmt.Errorf("no certificates found")
+		}
+	}
+	if certPool.pool != nil {
+		log.Printf("@W Unable to reload client CA %v, keeping the loaded one: %v\n", certPool.File, err)
+		return certPool.pool, nil
+	}
+	return nil, fmt.Errorf("loading client CA %v: %w", certPool.File, err)
+}
+
+// newTLSServer creates the server for serving the provider endpoint over TLS.
+// The certificate and client CA are reloaded when the files change. With a client CA every client must present
+// a certificate signed by it, and with allowed clients the certificate subject common name or one of its
+// DNS, URI or email SANs must be in the list.
+func newTLSServer(address string, handler http.Handler) (*http.Server, error) {
+	keyPair, err := newReloadingKeyPair(Config.TLS.CertFile, Config.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var clientCAs *reloadingCertPool
+	if Config.TLS.ClientCAFile != "" {
+		clientCAs = &reloadingCertPool{File: Config.TLS.ClientCAFile}
+		if _, err := clientCAs.get(); err != nil {
+			return nil, err
+		}
+	}
+	allowedClients := splitList(Config.TLS.AllowedClients)
+	if len(allowedClients) > 0 && clientCAs == nil {
+		return nil, fmt.Errorf("TOOC_TLS_ALLOWEDCLIENTS requires TOOC_TLS_CLIENTCAFILE")
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	// The config for the connection replaces the base config, so the protocols are copied for HTTP/2 to be negotiated
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		config := &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: tlsConfig.NextProtos,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return keyPair.get()
+			},
+		}
+		if clientCAs != nil {
+			pool, err := clientCAs.get()
+			if err != nil {
+				return nil, err
+			}
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+			config.ClientCAs = pool
+		}
+		if len(allowedClients) > 0 {
+			config.VerifyConnection = func(state tls.ConnectionState) error {
+				return verifyAllowedClient(state, allowedClients)
+			}
+		}
+		return config, nil
+	}
+	return &http.Server{
+		Addr:      address,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}, nil
+}
+
+// verifyAllowedClient checks the verified client certificate against the allowed subjects and SANs
+func verifyAllowedClient(state tls.ConnectionState, allowedClients []string) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("no client certificate")
+	}
+	certificate := state.PeerCertificates[0]
+	for _, name := range getCertificateNames(certificate) {
+		if slices.Contains(allowedClients, name) {
+			return nil
+		}
+	}
+	log.Printf("@W Rejected client certificate %v, not in TOOC_TLS_ALLOWEDCLIENTS\n", certificate.Subject)
+	return fmt.Errorf("client certificate %v is not allowed", certificate.Subject)
+}
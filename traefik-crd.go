@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	traefikconfig "github.com/traefik/traefik/v3/pkg/config/dynamic"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Traefik IngressRoute and IngressRouteTCP objects are read through the dynamic client like the Gateway API objects.
+// https://doc.traefik.io/traefik/reference/routing-configuration/kubernetes/crd/http/ingressroute/
+const (
+	TraefikGroup            = "traefik.io"
+	IngressRouteKind        = "ingressroute"
+	IngressRouteTCPKind     = "ingressroutetcp"
+	LablePort               = LablePrefix + "port" // Port on the Traefik load balancer for routes that are not bound to a hostname
+	TraefikCatchAllHostSNI  = "HostSNI(`*`)"
+	TraefikServiceSeparator = "/"
+)
+
+var (
+	IngressRouteResource    = schema.GroupVersionResource{Group: TraefikGroup, Version: "v1alpha1", Resource: "ingressroutes"}
+	IngressRouteTCPResource = schema.GroupVersionResource{Group: TraefikGroup, Version: "v1alpha1", Resource: "ingressroutetcps"}
+
+	// Matches Host and HostRegexp matchers and their arguments, one in v3 rules and a list in v2 rules
+	hostMatcherExpression = regexp.MustCompile("(Host|HostRegexp)\\(((?:\\s*[`\"][^`\"]*[`\"]\\s*,?)+)\\)")
+	// Matches the quoted arguments of a matcher
+	matcherArgumentExpression = regexp.MustCompile("[`\"]([^`\"]*)[`\"]")
+	// Matches Host and HostSNI matchers on an exact host, HostSNI(`*`) is a catch-all
+	exactHostExpression = regexp.MustCompile("(Host|HostSNI)\\(\\s*[`\"][^`\"*]+[`\"]")
+)
+
+type traefikIngressRoute struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		EntryPoints []string `json:"entryPoints,omitempty"`
+		Routes      []struct {
+			Match    string `json:"match"`
+			Priority int    `json:"priority,omitempty"`
+			Syntax   string `json:"syntax,omitempty"`
+		} `json:"routes"`
+		TLS *struct{} `json:"tls,omitempty"`
+	} `json:"spec"`
+}
+
+type traefikIngressRouteTCP struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Routes []struct {
+			Match    string `json:"match"`
+			Priority int    `json:"priority,omitempty"`
+			Syntax   string `json:"syntax,omitempty"`
+		} `json:"routes"`
+		TLS *struct {
+			Passthrough bool `json:"passthrough,omitempty"`
+		} `json:"tls,omitempty"`
+	} `json:"spec"`
+}
+
+// startTraefikInformers registers the IngressRoute informers filtered by the export label,
+// and when configured an informer for the Traefik service to get the load balancer address from.
+func (kube *KubeClient) startTraefikInformers(dynamicClient dynamic.Interface) ([]cache.InformerSynced, error) {
+	routeFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 0, metav1.NamespaceAll,
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = fmt.Sprintf("%v=%v", LableExported, ExportedTrue)
+		})
+	sharedInformers := []cache.SharedIndexInformer{}
+	for resource, lister := range map[schema.GroupVersionResource]*cache.GenericLister{
+		IngressRouteResource:    &kube.ingressRouteLister,
+		IngressRouteTCPResource: &kube.ingressRouteTCPLister,
+	} {
+		if !kube.resourceAvailable(resource) {
+			log.Printf("@W %v is not served by the cluster, not exporting %v\n", resource, resource.Resource)
+			continue
+		}
+		*lister = routeFactory.ForResource(resource).Lister()
+		sharedInformers = append(sharedInformers, routeFactory.ForResource(resource).Informer())
+	}
+	if Config.Cluster.Traefik.Service != "" {
+		namespace, name, found := strings.Cut(Config.Cluster.Traefik.Service, TraefikServiceSeparator)
+		if !found {
+			return nil, fmt.Errorf("TOOC_CLUSTER_TRAEFIK_SERVICE %v is not in the namespace/name format", Config.Cluster.Traefik.Service)
+		}
+		serviceFactory := informers.NewSharedInformerFactoryWithOptions(kube.client, 0,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+			}))
+		serviceInformer := serviceFactory.Core().V1().Services()
+		kube.traefikServiceLister = serviceInformer.Lister()
+		sharedInformers = append(sharedInformers, serviceInformer.Informer())
+		serviceFactory.Start(kube.context.Done())
+	}
+	synced := []cache.InformerSynced{}
+	for _, informer := range sharedInformers {
+		_, err := informer.AddEventHandler(kube.rebuildEventHandler())
+		if err != nil {
+			return nil, err
+		}
+		synced = append(synced, informer.HasSynced)
+	}
+	routeFactory.Start(kube.context.Done())
+	return synced, nil
+}
+
+// getTraefikAddresses returns the load balancer addresses of the in cluster Traefik,
+// the configured ingress address takes precedence like it does for ingresses.
+func (kube *KubeClient) getTraefikAddresses() []string {
+	statusAddresses := []string{}
+	if kube.traefikServiceLister != nil {
+		namespace, name, _ := strings.Cut(Config.Cluster.Traefik.Service, TraefikServiceSeparator)
+		service, err := kube.traefikServiceLister.Services(namespace).Get(name)
+		if err != nil {
+			log.Printf("@W getTraefikAddresses: unable to get traefik service %v: %v\n", Config.Cluster.Traefik.Service, err)
+		} else {
+			statusAddresses = getServiceStatusAddresses(service)
+		}
+	}
+	return getLoadBalancerAddresses(statusAddresses)
+}
+
+// getHostSNIRule turns the Host and HostRegexp matchers of an HTTP rule into a HostSNI rule for TLS passthrough,
+// returns an empty string if the rule has no host matchers.
+func getHostSNIRule(match string) string {
+	sniMatchers := []string{}
+	for _, matcher := range getHostMatchers(match) {
+		if matcher.regexp {
+			sniMatchers = append(sniMatchers, fmt.Sprintf("HostSNIRegexp(`%v`)", matcher.host))
+		} else {
+			sniMatchers = append(sniMatchers, fmt.Sprintf("HostSNI(`%v`)", matcher.host))
+		}
+	}
+	return strings.Join(sniMatchers, " || ")
+}
+
+// getRoutePriority puts a route of a Traefik CRD on the priority scheme of the other sources. Without a priority
+// Traefik uses the rule length, and rules on an exact host get ExactHostPriority on top like the ingress routers.
+func getRoutePriority(match string, priority int) int {
+	if priority == 0 {
+		priority = len(match)
+	}
+	if exactHostExpression.MatchString(match) {
+		priority += ExactHostPriority
+	}
+	return priority
+}
+
+type hostMatcher struct {
+	host   string
+	regexp bool // HostRegexp instead of Host
+}
+
+// getHostMatchers returns the hosts of the Host and HostRegexp matchers of a rule, v2 rules can list several in one matcher
+func getHostMatchers(rule string) []hostMatcher {
+	matchers := []hostMatcher{}
+	for _, found := range hostMatcherExpression.FindAllStringSubmatch(rule, -1) {
+		for _, argument := range matcherArgumentExpression.FindAllStringSubmatch(found[2], -1) {
+			matchers = append(matchers, hostMatcher{host: argument[1], regexp: found[1] == "HostRegexp"})
+		}
+	}
+	return matchers
+}
+
+// getIngressRouteEntrypoints reports whether an IngressRoute is served on the HTTP and the HTTPS entrypoint of the
+// in cluster Traefik, which is expected to use the same entrypoint names. Without entryPoints a route is on every entrypoint.
+func getIngressRouteEntrypoints(entryPoints []string) (bool, bool) {
+	if len(entryPoints) == 0 {
+		return true, true
+	}
+	return slices.Contains(entryPoints, Config.Traefik.HTTP.Entrypoint.Name), slices.Contains(entryPoints, Config.Traefik.HTTPS.Entrypoint.Name)
+}
+
+// appendTraefikRoutes adds routers for exported IngressRoute and IngressRouteTCP objects.
+// The match expression is passed on verbatim, TLS passthrough routers get a HostSNI rule built from the Host matchers.
+func (kube *KubeClient) appendTraefikRoutes(traefikConfig *configBuilder) (int, error) {
+	ingressRoutes, err := listDynamicObjects[traefikIngressRoute](kube.ingressRouteLister)
+	if err != nil {
+		return 0, err
+	}
+	ingressRouteTCPs, err := listDynamicObjects[traefikIngressRouteTCP](kube.ingressRouteTCPLister)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(ingressRoutes, func(i, j int) bool {
+		return ingressRoutes[i].Namespace+"/"+ingressRoutes[i].Name < ingressRoutes[j].Namespace+"/"+ingressRoutes[j].Name
+	})
+	sort.Slice(ingressRouteTCPs, func(i, j int) bool {
+		return ingressRouteTCPs[i].Namespace+"/"+ingressRouteTCPs[i].Name < ingressRouteTCPs[j].Namespace+"/"+ingressRouteTCPs[j].Name
+	})
+	if Config.Debug {
+		log.Printf("@D appendTraefikRoutes: found %v ingressroutes, %v ingressroutetcps\n", len(ingressRoutes), len(ingressRouteTCPs))
+	}
+	addresses := kube.getTraefikAddresses()
+
+	total_rules := 0
+	broken := map[string]int{IngressRouteKind: 0, IngressRouteTCPKind: 0}
+	for _, route := range ingressRoutes {
+		if !traefikConfig.includes(&route) {
+			continue
+		}
+		if len(addresses) == 0 {
+			log.Printf("@W appendTraefikRoutes: no traefik address for ingressroute %v/%v, skipping\n", route.Namespace, route.Name)
+			broken[IngressRouteKind] += 1
+			continue
+		}
+		SSLForwardType, forwardOK := getOption(&route, LableSSLForwardType)
+		if !forwardOK {
+			SSLForwardType = SSLForwardTypePassthrough
+		}
+		if _, ok := getOption(&route, LableRewriteHostname); ok {
+			log.Printf("@W appendTraefikRoutes: %v is not supported on ingressroute %v/%v, ignoring\n", LableRewriteHostname, route.Namespace, route.Name)
+		}
+		onHTTP, onHTTPS := getIngressRouteEntrypoints(route.Spec.EntryPoints)
+		if !onHTTP && !onHTTPS {
+			log.Printf("@W appendTraefikRoutes: ingressroute %v/%v is not on the %v or %v entrypoint, skipping\n", route.Namespace, route.Name, Config.Traefik.HTTP.Entrypoint.Name, Config.Traefik.HTTPS.Entrypoint.Name)
+			broken[IngressRouteKind] += 1
+			continue
+		}
+		// A route put on the HTTPS entrypoint gets TLS from the entrypoint when it has no tls section
+		tls := onHTTPS && (route.Spec.TLS != nil || len(route.Spec.EntryPoints) > 0)
+		name := fmt.Sprintf("%v-%v-%v-%v", CommonName, route.Namespace, IngressRouteKind, route.Name)
+		httpMiddlewares, tcpMiddlewares, err := kube.getAppendMiddlewares(traefikConfig, name, &route)
+		if err != nil {
+			log.Printf("@W appendTraefikRoutes: ingressroute %v/%v is not exported: %v\n", route.Namespace, route.Name, err)
+			broken[IngressRouteKind] += 1
+			continue
+		}
+		currentService := kube.getAppendServiceNames(traefikConfig, addresses, "")
+		for id, routeSpec := range route.Spec.Routes {
+			routerName := fmt.Sprintf("%v-%v", name, id)
+			if onHTTP {
+				traefikConfig.HTTP.Routers[routerName] = &traefikconfig.Router{
+					EntryPoints: []string{traefikConfig.httpEntrypoint()},
+					Rule:        routeSpec.Match,
+					RuleSyntax:  routeSpec.Syntax,
+					Priority:    getRoutePriority(routeSpec.Match, routeSpec.Priority),
+					Middlewares: httpMiddlewares,
+					Service:     currentService.HTTPServiceName,
+				}
+			}
+			if !tls {
+				total_rules += 1
+				continue
+			}
+			if SSLForwardType == SSLForwardTypeReEncrypt {
+				traefikConfig.HTTP.Routers[routerName+"-tls"] = &traefikconfig.Router{
+					EntryPoints: []string{traefikConfig.httpsEntrypoint()},
+					Rule:        routeSpec.Match,
+					RuleSyntax:  routeSpec.Syntax,
+					Priority:    getRoutePriority(routeSpec.Match, routeSpec.Priority),
+					Middlewares: httpMiddlewares,
+					Service:     currentService.HTTPSServiceName,
+					TLS:         &traefikconfig.RouterTLSConfig{},
+				}
+			} else if SSLForwardType == SSLForwardTypePassthrough {
+				sniRule := getHostSNIRule(routeSpec.Match)
+				if sniRule == "" {
+					log.Printf("@W appendTraefikRoutes: ingressroute %v/%v route %v has no Host matcher, unable to create passthrough router\n", route.Namespace, route.Name, id)
+				} else {
+					traefikConfig.TCP.Routers[routerName+"-tls"] = &traefikconfig.TCPRouter{
+						EntryPoints: []string{traefikConfig.httpsEntrypoint()},
+						Rule:        sniRule,
+						RuleSyntax:  routeSpec.Syntax,
+						Priority:    getRoutePriority(sniRule, 0),
+						Middlewares: tcpMiddlewares,
+						Service:     currentService.TCPServiceName,
+						TLS:         &traefikconfig.RouterTCPTLSConfig{Passthrough: true},
+					}
+				}
+			} else {
+				log.Printf("@W appendTraefikRoutes: Unsupported label option %v=%v", LableSSLForwardType, SSLForwardType)
+			}
+			total_rules += 1
+		}
+	}
+	for _, route := range ingressRouteTCPs {
+		if !traefikConfig.includes(&route) {
+			continue
+		}
+		name := fmt.Sprintf("%v-%v-%v-%v", CommonName, route.Namespace, IngressRouteTCPKind, route.Name)
+		entrypoint, entrypointOK := getOption(&route, LableEntrypoint)
+		port, _ := getOption(&route, LablePort)
+		if _, err := strconv.Atoi(port); entrypointOK && err != nil {
+			log.Printf("@W appendTraefikRoutes: ingressroutetcp %v/%v has %v without a valid %v, skipping\n", route.Namespace, route.Name, LableEntrypoint, LablePort)
+			broken[IngressRouteTCPKind] += 1
+			continue
+		}
+		if len(addresses) == 0 {
+			log.Printf("@W appendTraefikRoutes: no traefik address for ingressroutetcp %v/%v, skipping\n", route.Namespace, route.Name)
+			broken[IngressRouteTCPKind] += 1
+			continue
+		}
+		middlewares, err := kube.getAppendTCPMiddlewares(traefikConfig, name, &route)
+		if err != nil {
+			log.Printf("@W appendTraefikRoutes: ingressroutetcp %v/%v is not exported: %v\n", route.Namespace, route.Name, err)
+			broken[IngressRouteTCPKind] += 1
+			continue
+		}
+		serviceName := ""
+		if entrypointOK {
+			// Port based route, forwarded to the entrypoint port on the in cluster Traefik
+			serviceName = name
+			traefikConfig.TCP.Services[serviceName] = &traefikconfig.TCPService{
+				LoadBalancer: &traefikconfig.TCPServersLoadBalancer{
+					Servers: getTCPServers(addresses, port),
+				}}
+		} else {
+			// Host based route, forwarded to the websecure entrypoint
+			entrypoint = traefikConfig.httpsEntrypoint()
+			serviceName = kube.getAppendServiceNames(traefikConfig, addresses, "").TCPServiceName
+		}
+		for id, routeSpec := range route.Spec.Routes {
+			if !entrypointOK && (route.Spec.TLS == nil || routeSpec.Match == TraefikCatchAllHostSNI) {
+				log.Printf("@W appendTraefikRoutes: ingressroutetcp %v/%v route %v is not routed by SNI and needs the %v and %v labels, skipping\n", route.Namespace, route.Name, id, LableEntrypoint, LablePort)
+				broken[IngressRouteTCPKind] += 1
+				continue
+			}
+			router := &traefikconfig.TCPRouter{
+				EntryPoints: []string{entrypoint},
+				Rule:        routeSpec.Match,
+				RuleSyntax:  routeSpec.Syntax,
+				Priority:    getRoutePriority(routeSpec.Match, routeSpec.Priority),
+				Middlewares: middlewares,
+				Service:     serviceName,
+			}
+			if route.Spec.TLS != nil && routeSpec.Match != TraefikCatchAllHostSNI {
+				router.TLS = &traefikconfig.RouterTCPTLSConfig{Passthrough: true}
+			}
+			traefikConfig.TCP.Routers[fmt.Sprintf("%v-%v", name, id)] = router
+			total_rules += 1
+		}
+	}
+	if traefikConfig.reportMetrics() {
+		exported_traefik_routes_count.WithLabelValues(IngressRouteKind).Set(float64(len(ingressRoutes)))
+		exported_traefik_routes_count.WithLabelValues(IngressRouteTCPKind).Set(float64(len(ingressRouteTCPs)))
+		for kind, count := range broken {
+			broken_traefik_routes_count.WithLabelValues(kind).Set(float64(count))
+		}
+	}
+	return total_rules, nil
+}
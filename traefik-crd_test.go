@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestIngress(name string, host string, path string) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+			Host: host,
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{{Path: path, PathType: &pathType}},
+			}},
+		}}},
+	}
+}
+
+// TestIngressRoutePriorityWithIngress checks that IngressRoutes are ranked like ingresses on the same host:
+// the longer IngressRoute rule wins over the ingress on its exact host, and both win over a wildcard host.
+func TestIngressRoutePriorityWithIngress(t *testing.T) {
+	saved := Config
+	t.Cleanup(func() { Config = saved })
+	Config.Cluster.Ingress.Address = "10.0.0.1"
+	Config.Sources.TraefikCRD.Enabled = true
+
+	ingresses := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ingress := range []*networkingv1.Ingress{
+		newTestIngress("exact", "a.example.com", "/"),
+		newTestIngress("wildcard", "*.example.com", "/a/very/long/path/on/the/wildcard/host"),
+	} {
+		if err := ingresses.Add(ingress); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ingressRoutes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	err := ingressRoutes.Add(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": TraefikGroup + "/v1alpha1",
+		"kind":       "IngressRoute",
+		"metadata":   map[string]interface{}{"namespace": "default", "name": "api"},
+		"spec": map[string]interface{}{"routes": []interface{}{
+			map[string]interface{}{"match": "Host(`a.example.com`) && PathPrefix(`/api`)"},
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kube := &KubeClient{
+		ingressLister:         networkinglisters.NewIngressLister(ingresses),
+		ingressRouteLister:    cache.NewGenericLister(ingressRoutes, IngressRouteResource.GroupResource()),
+		ingressRouteTCPLister: cache.NewGenericLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}), IngressRouteTCPResource.GroupResource()),
+	}
+
+	config, err := kube.getTraefikConfiguration(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routers := config.HTTP.Routers
+	for _, name := range []string{"tooc-default-exact-0", "tooc-default-wildcard-0", "tooc-default-" + IngressRouteKind + "-api-0"} {
+		if routers[name] == nil {
+			t.Fatalf("router %v is missing, got %v", name, routers)
+		}
+	}
+	ingressRoute := routers["tooc-default-"+IngressRouteKind+"-api-0"].Priority
+	exact := routers["tooc-default-exact-0"].Priority
+	wildcard := routers["tooc-default-wildcard-0"].Priority
+	if ingressRoute <= exact || exact <= wildcard {
+		t.Errorf("priorities ingressroute %v, exact ingress %v, wildcard ingress %v are not in that order", ingressRoute, exact, wildcard)
+	}
+}
+
+func TestGetRoutePriority(t *testing.T) {
+	for _, test := range []struct {
+		match    string
+		priority int
+		expected int
+	}{
+		{"Host(`a.example.com`)", 0, ExactHostPriority + len("Host(`a.example.com`)")},
+		{"Host(`a.example.com`)", 5, ExactHostPriority + 5},
+		{"Host(`a.example.com`, `b.example.com`)", 0, ExactHostPriority + len("Host(`a.example.com`, `b.example.com`)")},
+		{"HostRegexp(`^.+\\.example\\.com$`)", 0, len("HostRegexp(`^.+\\.example\\.com$`)")},
+		{"HostSNI(`a.example.com`)", 0, ExactHostPriority + len("HostSNI(`a.example.com`)")},
+		{"HostSNIRegexp(`^.+\\.example\\.com$`)", 0, len("HostSNIRegexp(`^.+\\.example\\.com$`)")},
+		{TraefikCatchAllHostSNI, 0, len(TraefikCatchAllHostSNI)},
+		{"PathPrefix(`/api`)", 0, len("PathPrefix(`/api`)")},
+	} {
+		if priority := getRoutePriority(test.match, test.priority); priority != test.expected {
+			t.Errorf("getRoutePriority(%q, %v) is %v, expected %v", test.match, test.priority, priority, test.expected)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// configProblem is a problem found in the configuration. Fatal problems stop the server from starting,
+// the others are logged as warnings.
+type configProblem struct {
+	Option  string // Environment variable of the option
+	Message string
+	Fatal   bool
+}
+
+func (problem configProblem) String() string {
+	if problem.Option == "" {
+		return problem.Message
+	}
+	return problem.Option + ": " + problem.Message
+}
+
+// configValidator collects every problem, so all of them can be fixed in one go
+type configValidator struct {
+	problems []configProblem
+}
+
+func (validator *configValidator) fatal(option string, format string, args ...interface{}) {
+	validator.problems = append(validator.problems, configProblem{Option: option, Message: fmt.Sprintf(format, args...), Fatal: true})
+}
+
+func (validator *configValidator) warn(option string, format string, args ...interface{}) {
+	validator.problems = append(validator.problems, configProblem{Option: option, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateConfig checks the loaded configuration and returns every problem found
+func validateConfig(config *ConfigType) []configProblem {
+	validator := &configValidator{}
+	validator.port("TOOC_PORT", config.Port, true)
+
+	validator.port("TOOC_CLUSTER_INGRESS_HTTP_PORT", config.Cluster.Ingress.HTTP.Port, true)
+	validator.protocol("TOOC_CLUSTER_INGRESS_HTTP_PROTOCOL", config.Cluster.Ingress.HTTP.Protocol, true)
+	validator.port("TOOC_CLUSTER_INGRESS_HTTPS_PORT", config.Cluster.Ingress.HTTPS.Port, true)
+	validator.protocol("TOOC_CLUSTER_INGRESS_HTTPS_PROTOCOL", config.Cluster.Ingress.HTTPS.Protocol, true)
+	validator.port("TOOC_CLUSTER_INGRESS_ALT_HTTP_PORT", config.Cluster.Ingress.Alternate.HTTP.Port, false)
+	validator.protocol("TOOC_CLUSTER_INGRESS_ALT_HTTP_PROTOCOL", config.Cluster.Ingress.Alternate.HTTP.Protocol, false)
+	validator.port("TOOC_CLUSTER_INGRESS_ALT_HTTPS_PORT", config.Cluster.Ingress.Alternate.HTTPS.Port, false)
+	validator.protocol("TOOC_CLUSTER_INGRESS_ALT_HTTPS_PROTOCOL", config.Cluster.Ingress.Alternate.HTTPS.Protocol, false)
+	for _, address := range splitList(config.Cluster.Ingress.Address) {
+		if !isValidAddress(address) {
+			validator.fatal("TOOC_CLUSTER_INGRESS_ADDRESS", "%q is not a valid IP address or hostname", address)
+		}
+	}
+	if config.Cluster.RootCAFilename == "" {
+		validator.warn("TOOC_CLUSTER_ROOTCAFILENAME", "not set, the servers transports of %v ingresses use the system roots of the external Traefik instead of the cluster CA", LableRewriteHostname)
+	}
+	if config.Cluster.Traefik.Service != "" {
+		if namespace, name, found := strings.Cut(config.Cluster.Traefik.Service, "/"); !found || namespace == "" || name == "" {
+			validator.fatal("TOOC_CLUSTER_TRAEFIK_SERVICE", "%q must be namespace/name", config.Cluster.Traefik.Service)
+		}
+	}
+	if config.Cluster.Kubeconfig != "" {
+		validator.file("TOOC_CLUSTER_KUBECONFIG", config.Cluster.Kubeconfig, true)
+	}
+
+	validator.entrypoint("TOOC_TRAEFIK_HTTP_ENTRYPOINT_NAME", config.Traefik.HTTP.Entrypoint.Name)
+	validator.entrypoint("TOOC_TRAEFIK_HTTPS_ENTRYPOINT_NAME", config.Traefik.HTTPS.Entrypoint.Name)
+	validator.entrypoint("TOOC_TRAEFIK_TCP_ENTRYPOINT_NAME", config.Traefik.TCP.Entrypoint.Name)
+	validator.entrypoint("TOOC_TRAEFIK_UDP_ENTRYPOINT_NAME", config.Traefik.UDP.Entrypoint.Name)
+
+	validator.path("TOOC_PROMETHEUS_ENDPOINT", config.Prometheus.Endpoint)
+	validator.path("TOOC_HEALTH_ENDPOINT", config.Health.Endpoint)
+	validator.path("TOOC_AGGREGATION_CONFLICTSENDPOINT", config.Aggregation.ConflictsEndpoint)
+	if config.History.Size < 0 {
+		validator.fatal("TOOC_HISTORY_SIZE", "must not be negative")
+	}
+	if config.History.Size > 0 {
+		validator.path("TOOC_HISTORY_ENDPOINT", config.History.Endpoint)
+	}
+
+	switch config.Aggregation.ConflictPolicy {
+	case ConflictPolicyFirstWins, ConflictPolicyPriority, ConflictPolicyReject, ConflictPolicyCombine, ConflictPolicyFailover:
+	default:
+		validator.warn("TOOC_AGGREGATION_CONFLICTPOLICY", "unknown conflict policy %q, %v is used", config.Aggregation.ConflictPolicy, ConflictPolicyPriority)
+	}
+	if config.Aggregation.LocalWeight < 0 {
+		validator.fatal("TOOC_AGGREGATION_LOCALWEIGHT", "must not be negative")
+	}
+	if config.Aggregation.ConflictPolicy == ConflictPolicyFailover && config.Aggregation.HealthCheck.Path == "" {
+		validator.fatal("TOOC_AGGREGATION_HEALTHCHECK_PATH", "must be set with the %v conflict policy, without health checks Traefik never fails over", ConflictPolicyFailover)
+	}
+	if config.Aggregation.HealthCheck.Path != "" && !strings.HasPrefix(config.Aggregation.HealthCheck.Path, "/") {
+		validator.fatal("TOOC_AGGREGATION_HEALTHCHECK_PATH", "%q must start with /", config.Aggregation.HealthCheck.Path)
+	}
+	if config.Aggregation.HealthCheck.Path != "" && config.Aggregation.HealthCheck.Interval <= 0 {
+		validator.fatal("TOOC_AGGREGATION_HEALTHCHECK_INTERVAL", "must be a positive number of seconds")
+	}
+
+	if config.TLS.CertFile != "" || config.TLS.KeyFile != "" {
+		validator.keyPair("TOOC_TLS_CERTFILE", config.TLS.CertFile, "TOOC_TLS_KEYFILE", config.TLS.KeyFile)
+	}
+	if config.TLS.ClientCAFile != "" {
+		if config.TLS.CertFile == "" {
+			validator.warn("TOOC_TLS_CLIENTCAFILE", "has no effect without TOOC_TLS_CERTFILE, client certificates are only checked when serving TLS")
+		}
+		validator.file("TOOC_TLS_CLIENTCAFILE", config.TLS.ClientCAFile, true)
+	}
+	if config.TLS.AllowedClients != "" && config.TLS.ClientCAFile == "" {
+		validator.fatal("TOOC_TLS_ALLOWEDCLIENTS", "requires TOOC_TLS_CLIENTCAFILE")
+	}
+
+	viewNames := make(map[string]bool)
+	for i, view := range config.Views {
+		option := fmt.Sprintf("TOOC_VIEWS_%d_NAME", i)
+		if viewNames[view.Name] {
+			validator.fatal(option, "view %q is defined more than once", view.Name)
+		}
+		viewNames[view.Name] = true
+		if strings.Contains(view.Name, "/") {
+			validator.fatal(option, "view name %q must not contain /", view.Name)
+		}
+		if view.Clients != "" && config.TLS.ClientCAFile == "" {
+			validator.warn(fmt.Sprintf("TOOC_VIEWS_%d_CLIENTS", i), "has no effect without TOOC_TLS_CLIENTCAFILE")
+		}
+	}
+
+	childNames := make(map[string]bool)
+	for i, child := range config.Children {
+		validator.child(i, child, childNames)
+	}
+
+	if config.Redis.Address != "" {
+		if _, _, err := net.SplitHostPort(config.Redis.Address); err != nil {
+			validator.fatal("TOOC_REDIS_ADDRESS", "%q must be host:port", config.Redis.Address)
+		}
+		if config.Redis.PasswordFile != "" {
+			validator.file("TOOC_REDIS_PASSWORDFILE", config.Redis.PasswordFile, false)
+		}
+		if config.Redis.RootKey == "" {
+			validator.fatal("TOOC_REDIS_ROOTKEY", "must not be empty")
+		}
+	}
+	if config.File.Directory != "" {
+		if config.File.Format != FileFormatYAML && config.File.Format != FileFormatTOML {
+			validator.fatal("TOOC_FILE_FORMAT", "unknown file format %q, use %v or %v", config.File.Format, FileFormatYAML, FileFormatTOML)
+		}
+		if info, err := os.Stat(config.File.Directory); err != nil || !info.IsDir() {
+			validator.fatal("TOOC_FILE_DIRECTORY", "%v is not a directory", config.File.Directory)
+		}
+	}
+	return validator.problems
+}
+
+func (validator *configValidator) child(index int, child ChildControllerConfig, names map[string]bool) {
+	option := func(field string) string {
+		return fmt.Sprintf("TOOC_CHILDREN_%d_%v", index, field)
+	}
+	if names[child.Name] {
+		validator.fatal(option("NAME"), "child %q is defined more than once, names are used as prefix and must be unique", child.Name)
+	}
+	names[child.Name] = true
+	if strings.ContainsAny(child.Name, ProviderSeparator+"/") {
+		validator.fatal(option("NAME"), "child name %q must not contain %v or /", child.Name, ProviderSeparator)
+	}
+	childURL, err := url.Parse(child.URL)
+	if err != nil {
+		validator.fatal(option("URL"), "%q is not a valid URL: %v", child.URL, err)
+	} else if childURL.Scheme != "http" && childURL.Scheme != "https" || childURL.Host == "" {
+		validator.fatal(option("URL"), "%q must be an absolute http:// or https:// URL", child.URL)
+	}
+	if child.Timeout < 0 {
+		validator.fatal(option("TIMEOUT"), "must not be negative")
+	}
+	if child.MaxStaleness < 0 {
+		validator.fatal(option("MAXSTALENESS"), "must not be negative")
+	}
+	if child.Weight != nil && *child.Weight < 0 {
+		validator.fatal(option("WEIGHT"), "must not be negative")
+	}
+	if child.RootCAFile != "" {
+		validator.file(option("ROOTCAFILE"), child.RootCAFile, false)
+	}
+	if child.ClientCertFile != "" || child.ClientKeyFile != "" {
+		validator.keyPair(option("CLIENTCERTFILE"), child.ClientCertFile, option("CLIENTKEYFILE"), child.ClientKeyFile)
+	}
+	if child.BearerToken != "" && child.BearerTokenFile != "" {
+		validator.warn(option("BEARERTOKEN"), "TOOC_CHILDREN_%d_BEARERTOKENFILE is used instead", index)
+	}
+	if child.BearerTokenFile != "" {
+		validator.file(option("BEARERTOKENFILE"), child.BearerTokenFile, false)
+	}
+	if child.Password != "" && child.PasswordFile != "" {
+		validator.warn(option("PASSWORD"), "TOOC_CHILDREN_%d_PASSWORDFILE is used instead", index)
+	}
+	if child.PasswordFile != "" {
+		validator.file(option("PASSWORDFILE"), child.PasswordFile, false)
+	}
+	if (child.Password != "" || child.PasswordFile != "") && child.Username == "" {
+		validator.fatal(option("USERNAME"), "required with a password")
+	}
+	if childURL != nil && childURL.Scheme == "http" && (child.BearerToken != "" || child.BearerTokenFile != "" || child.Username != "") {
+		validator.warn(option("URL"), "credentials are sent unencrypted over http")
+	}
+}
+
+func (validator *configValidator) port(option string, value string, required bool) {
+	if value == "" {
+		if required {
+			validator.fatal(option, "must be set")
+		}
+		return
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		validator.fatal(option, "%q is not a port number between 1 and 65535", value)
+	}
+}
+
+func (validator *configValidator) protocol(option string, value string, required bool) {
+	if value == "" && !required {
+		return
+	}
+	if value != "http" && value != "https" {
+		validator.fatal(option, "unknown protocol %q, use http or https", value)
+	}
+}
+
+func (validator *configValidator) entrypoint(option string, value string) {
+	if strings.TrimSpace(value) == "" {
+		validator.fatal(option, "must be set")
+	}
+}
+
+func (validator *configValidator) path(option string, value string) {
+	if !strings.HasPrefix(value, "/") {
+		validator.fatal(option, "%q must start with /", value)
+	}
+}
+
+// keyPair checks that a certificate and its key are set together and can be read
+func (validator *configValidator) keyPair(certOption string, certFile string, keyOption string, keyFile string) {
+	if certFile == "" {
+		validator.fatal(certOption, "required with %v", keyOption)
+		return
+	}
+	if keyFile == "" {
+		validator.fatal(keyOption, "required with %v", certOption)
+		return
+	}
+	validator.file(certOption, certFile, false)
+	validator.file(keyOption, keyFile, false)
+}
+
+// file checks that a file can be read. Missing files mounted from secrets may still be issued,
+// so they are only fatal when required.
+func (validator *configValidator) file(option string, file string, required bool) {
+	handle, err := os.Open(file)
+	if err == nil {
+		handle.Close()
+		return
+	}
+	if required {
+		validator.fatal(option, "%v", err)
+	} else {
+		validator.warn(option, "%v", err)
+	}
+}
+
+// isValidAddress reports whether address is an IP address or a syntactically valid hostname.
+// Dotted numbers that are not an IP, like 192.168.20, are rejected.
+func isValidAddress(address string) bool {
+	if net.ParseIP(address) != nil {
+		return true
+	}
+	if strings.Trim(address, "0123456789.") == "" || len(address) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(address, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, char := range label {
+			if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || char == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// logConfigProblems logs the problems and reports whether any of them is fatal
+func logConfigProblems(problems []configProblem) bool {
+	fatal := false
+	for _, problem := range problems {
+		if problem.Fatal {
+			fatal = true
+			log.Printf("@E Configuration %v\n", problem)
+		} else {
+			log.Printf("@W Configuration %v\n", problem)
+		}
+	}
+	return fatal
+}
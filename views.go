@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/x509"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Views are filtered configurations for different consumers (DMZ, internal, partner edge).
+// An exported object opts in with tooc.k8s.stiil.dk/views: "dmz,internal" (an annotation, lists are not valid label values).
+// A view is served on /views/<name>, or on / to clients with a certificate identity listed for the view.
+// The full configuration on / keeps every exported object.
+const (
+	LableViews = LablePrefix + "views"
+	ViewsPath  = "/views/"
+)
+
+type ViewConfig struct {
+	Name            string `mapstructure:"Name"`
+	HTTPEntrypoint  string `mapstructure:"HTTPEntrypoint"`  // Overrides TOOC_TRAEFIK_HTTP_ENTRYPOINT_NAME in the view
+	HTTPSEntrypoint string `mapstructure:"HTTPSEntrypoint"` // Overrides TOOC_TRAEFIK_HTTPS_ENTRYPOINT_NAME in the view
+	Clients         string `mapstructure:"Clients"`         // Comma separated client certificate common names or SANs served this view on /
+}
+
+// getViewConfigsFromEnv loads the views from TOOC_VIEWS_<n>_<FIELD> environment variables in index order.
+// The variables override the fields of the view with the same index in views, the views from the file.
+func getViewConfigsFromEnv(views []ViewConfig) []ViewConfig {
+	viewConfigs := make(map[int]*ViewConfig)
+	for i := range views {
+		viewConfig := views[i]
+		viewConfigs[i] = &viewConfig
+	}
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "TOOC_VIEWS_") {
+			continue
+		}
+		key, value, found := strings.Cut(env, "=")
+		if !found {
+			continue
+		}
+		// Extract index and field from TOOC_VIEWS_0_NAME format
+		indexString, field, found := strings.Cut(strings.TrimPrefix(key, "TOOC_VIEWS_"), "_")
+		if !found {
+			continue
+		}
+		index, err := strconv.Atoi(indexString)
+		if err != nil {
+			continue
+		}
+		if viewConfigs[index] == nil {
+			viewConfigs[index] = &ViewConfig{}
+		}
+		switch field {
+		case "NAME":
+			viewConfigs[index].Name = value
+		case "HTTPENTRYPOINT":
+			viewConfigs[index].HTTPEntrypoint = value
+		case "HTTPSENTRYPOINT":
+			viewConfigs[index].HTTPSEntrypoint = value
+		case "CLIENTS":
+			viewConfigs[index].Clients = value
+		}
+	}
+	result := []ViewConfig{}
+	for i := 0; i < len(viewConfigs); i++ {
+		if viewConfig, ok := viewConfigs[i]; ok && viewConfig.Name != "" {
+			result = append(result, *viewConfig)
+			if Config.Debug {
+				log.Printf("@D Loaded view config %d: %+v\n", i, *viewConfig)
+			}
+		}
+	}
+	return result
+}
+
+// includes reports whether an exported object belongs in the configuration being built
+func (config *configBuilder) includes(object metav1.Object) bool {
+	if config.view == nil {
+		return true
+	}
+	views, _ := getOption(object, LableViews)
+	return slices.Contains(splitList(views), config.view.Name)
+}
+
+func (config *configBuilder) httpEntrypoint() string {
+	if config.view != nil && config.view.HTTPEntrypoint != "" {
+		return config.view.HTTPEntrypoint
+	}
+	return Config.Traefik.HTTP.Entrypoint.Name
+}
+
+func (config *configBuilder) httpsEntrypoint() string {
+	if config.view != nil && config.view.HTTPSEntrypoint != "" {
+		return config.view.HTTPSEntrypoint
+	}
+	return Config.Traefik.HTTPS.Entrypoint.Name
+}
+
+// reportMetrics is true for the full configuration only, so views don't overwrite the gauges with their subset
+func (config *configBuilder) reportMetrics() bool {
+	return Config.Prometheus.Enabled && config.view == nil
+}
+
+// getRequestView finds the view to serve for a request: the name in a /views/<name> path,
+// otherwise the view listing the client certificate. An empty name is the full configuration.
+func getRequestView(r *http.Request) (string, bool) {
+	if strings.HasPrefix(r.URL.Path, ViewsPath) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, ViewsPath), "/")
+		return name, getViewConfig(name) != nil
+	}
+	if view := getClientView(r); view != nil {
+		return view.Name, true
+	}
+	return "", true
+}
+
+// getClientView returns the view listing the client certificate of a request, nil for other clients
+func getClientView(r *http.Request) *ViewConfig {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	names := getCertificateNames(r.TLS.PeerCertificates[0])
+	for i, view := range Config.Views {
+		for _, client := range splitList(view.Clients) {
+			if slices.Contains(names, client) {
+				return &Config.Views[i]
+			}
+		}
+	}
+	return nil
+}
+
+// restrictViewClients keeps clients listed in a view to their own view, on / or /views/<name>.
+// Every other path, the other views and the debug endpoints included, is refused.
+func restrictViewClients(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		view := getClientView(r)
+		if view != nil && r.URL.Path != "/" && strings.TrimSuffix(r.URL.Path, "/") != ViewsPath+view.Name {
+			log.Printf("@I %v %v %v %v - client of view %v\n", r.Method, r.URL.Path, r.RemoteAddr, 403, view.Name)
+			http.Error(w, "403 Forbidden", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func getViewConfig(name string) *ViewConfig {
+	for i := range Config.Views {
+		if Config.Views[i].Name == name {
+			return &Config.Views[i]
+		}
+	}
+	return nil
+}
+
+// getCertificateNames returns the identities of a certificate: the subject common name and the DNS, email and URI SANs
+func getCertificateNames(certificate *x509.Certificate) []string {
+	names := []string{}
+	if certificate.Subject.CommonName != "" {
+		names = append(names, certificate.Subject.CommonName)
+	}
+	names = append(names, certificate.DNSNames...)
+	names = append(names, certificate.EmailAddresses...)
+	for _, uri := range certificate.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}